@@ -2,24 +2,27 @@ package aws
 
 import (
 	"context"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2Type "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"ya-ansible-inventory/cloud"
 	"ya-ansible-inventory/common"
 )
 
+// MakeCloudAWS makes EC2 client of every region of options
 func MakeCloudAWS() (*CloudAWS, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfgs, err := regionConfigs(context.TODO())
 	if err != nil {
 		return nil, err
 	}
-	client := ec2.NewFromConfig(cfg)
-	return &CloudAWS{api: client}, nil
+	ca := &CloudAWS{}
+	for _, cfg := range cfgs {
+		ca.api = append(ca.api, ec2.NewFromConfig(cfg))
+	}
+	return ca, nil
 }
 
 type CloudAWS struct {
-	api *ec2.Client
+	api []*ec2.Client
 }
 
 type HostAWS ec2Type.Instance
@@ -39,13 +42,45 @@ func (h *HostAWS) GetLabels() map[string]string {
 	return tagsToMap(h.Tags)
 }
 
+func (h *HostAWS) GetZone() string {
+	if h.Placement == nil || h.Placement.AvailabilityZone == nil {
+		return ""
+	}
+	return common.StringClone(*h.Placement.AvailabilityZone)
+}
+
+func (h *HostAWS) GetInstanceType() string {
+	return string(h.InstanceType)
+}
+
+func (h *HostAWS) GetPrivateDNS() string {
+	if h.PrivateDnsName == nil {
+		return ""
+	}
+	return common.StringClone(*h.PrivateDnsName)
+}
+
 func (h *HostAWS) GetInterfaces() cloud.Iface {
-	var pubIfs, priIfs []string
-	pubIfs = append(pubIfs, common.StringClone(*h.PublicIpAddress))
-	priIfs = append(priIfs, common.StringClone(*h.PrivateIpAddress))
+	var pubIfs, priIfs, subnets []string
+	// Instances without public address have nil PublicIpAddress
+	if h.PublicIpAddress != nil {
+		pubIfs = append(pubIfs, common.StringClone(*h.PublicIpAddress))
+	}
+	if h.PrivateIpAddress != nil {
+		priIfs = append(priIfs, common.StringClone(*h.PrivateIpAddress))
+	}
+	for _, i := range h.NetworkInterfaces {
+		if i.SubnetId != nil && !common.Contains(subnets, *i.SubnetId) {
+			subnets = append(subnets, common.StringClone(*i.SubnetId))
+		}
+	}
+	if len(subnets) < 1 && h.SubnetId != nil {
+		subnets = append(subnets, common.StringClone(*h.SubnetId))
+	}
 	return cloud.Iface{
 		Public:  pubIfs,
 		Private: priIfs,
+		Subnets: subnets,
 	}
 }
 
@@ -112,14 +147,16 @@ func (ca *CloudAWS) GetInstances(filter cloud.Filter) ([]cloud.Host, error) {
 
 func (ca *CloudAWS) getInstances() ([]*HostAWS, error) {
 	var result []*HostAWS
-	out, err := ca.api.DescribeInstances(context.TODO(), nil)
-	if err != nil {
-		return result, err
-	}
-	for _, r := range out.Reservations {
-		for _, i := range r.Instances {
-			h := HostAWS(i)
-			result = append(result, &h)
+	for _, api := range ca.api {
+		out, err := api.DescribeInstances(context.TODO(), nil)
+		if err != nil {
+			return result, err
+		}
+		for _, r := range out.Reservations {
+			for _, i := range r.Instances {
+				h := HostAWS(i)
+				result = append(result, &h)
+			}
 		}
 	}
 	return result, nil
@@ -144,13 +181,15 @@ func (ca *CloudAWS) GetVpcs(filter cloud.Filter) ([]cloud.VPC, error) {
 
 func (ca *CloudAWS) getVpcs() ([]*VpcAWS, error) {
 	var result []*VpcAWS
-	out, err := ca.api.DescribeVpcs(context.TODO(), nil)
-	if err != nil {
-		return result, err
-	}
-	for _, vpc := range out.Vpcs {
-		v := VpcAWS(vpc)
-		result = append(result, &v)
+	for _, api := range ca.api {
+		out, err := api.DescribeVpcs(context.TODO(), nil)
+		if err != nil {
+			return result, err
+		}
+		for _, vpc := range out.Vpcs {
+			v := VpcAWS(vpc)
+			result = append(result, &v)
+		}
 	}
 	return result, nil
 }
@@ -174,13 +213,15 @@ func (ca *CloudAWS) GetSubnets(filter cloud.Filter) ([]cloud.Subnet, error) {
 
 func (ca *CloudAWS) getSubNets() ([]*SubnetAWS, error) {
 	var result []*SubnetAWS
-	out, err := ca.api.DescribeSubnets(context.TODO(), nil)
-	if err != nil {
-		return result, err
-	}
-	for _, sub := range out.Subnets {
-		s := SubnetAWS(sub)
-		result = append(result, &s)
+	for _, api := range ca.api {
+		out, err := api.DescribeSubnets(context.TODO(), nil)
+		if err != nil {
+			return result, err
+		}
+		for _, sub := range out.Subnets {
+			s := SubnetAWS(sub)
+			result = append(result, &s)
+		}
 	}
 	return result, nil
 }
@@ -0,0 +1,118 @@
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"os"
+	"strings"
+)
+
+// Role is one step of assume role chain
+type Role struct {
+	Arn         string
+	ExternalId  string
+	SessionName string
+}
+
+// Options select credentials and regions of EC2 discovery and DynamoDB state backend
+type Options struct {
+	Profile string
+	Regions []string
+	// Roles are assumed in order, every role is assumed with credentials of previous one
+	Roles []Role
+}
+
+var options = OptionsFromEnv()
+
+// OptionsFromEnv reads AWS_PROFILE, comma separated AWS_REGIONS and AWS_ASSUME_ROLES,
+// AWS_EXTERNAL_ID of the last role and AWS_ROLE_SESSION_NAME of every role
+func OptionsFromEnv() Options {
+	o := Options{
+		Profile: os.Getenv("AWS_PROFILE"),
+		Regions: SplitList(os.Getenv("AWS_REGIONS")),
+	}
+	o.SetRoles(SplitList(os.Getenv("AWS_ASSUME_ROLES")), os.Getenv("AWS_EXTERNAL_ID"), os.Getenv("AWS_ROLE_SESSION_NAME"))
+	return o
+}
+
+// SetRoles replaces role chain, external id is set for the last role only
+func (o *Options) SetRoles(arns []string, externalId, sessionName string) {
+	o.Roles = nil
+	for _, arn := range arns {
+		o.Roles = append(o.Roles, Role{Arn: arn, SessionName: sessionName})
+	}
+	if len(o.Roles) > 0 {
+		o.Roles[len(o.Roles)-1].ExternalId = externalId
+	}
+}
+
+// SetOptions replaces options of clients made after the call
+func SetOptions(o Options) {
+	options = o
+}
+
+// LoadConfig loads config of default credential chain with profile and assume role chain of options.
+// Region of config is overridden if not empty
+func LoadConfig(ctx context.Context, region string) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if len(options.Profile) > 0 {
+		opts = append(opts, config.WithSharedConfigProfile(options.Profile))
+	}
+	if len(region) > 0 {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return cfg, err
+	}
+	for _, r := range options.Roles {
+		role := r
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role.Arn, func(o *stscreds.AssumeRoleOptions) {
+			if len(role.ExternalId) > 0 {
+				o.ExternalID = aws.String(role.ExternalId)
+			}
+			o.RoleSessionName = role.SessionName
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
+
+// StateRegion returns region if not empty, first region of options otherwise
+func StateRegion(region string) string {
+	if len(region) < 1 && len(options.Regions) > 0 {
+		return options.Regions[0]
+	}
+	return region
+}
+
+// regionConfigs returns config of every region of options, default region is used for empty list
+func regionConfigs(ctx context.Context) ([]aws.Config, error) {
+	regions := options.Regions
+	if len(regions) < 1 {
+		regions = []string{""}
+	}
+	var result []aws.Config
+	for _, region := range regions {
+		cfg, err := LoadConfig(ctx, region)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, cfg)
+	}
+	return result, nil
+}
+
+// SplitList splits comma separated list, empty items are dropped
+func SplitList(s string) []string {
+	var result []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -70,11 +70,19 @@ type Host interface {
 	GetId() string
 	GetLabels() map[string]string
 	GetInterfaces() Iface
+	// GetZone returns availability zone
+	GetZone() string
+	// GetInstanceType returns instance type of AWS or platform of Yandex Cloud
+	GetInstanceType() string
+	// GetPrivateDNS returns internal DNS name, FQDN of Yandex Cloud instance
+	GetPrivateDNS() string
 }
 
 type Iface struct {
 	Public  []string
 	Private []string
+	// Subnets are ids of subnets of interfaces
+	Subnets []string
 }
 
 type Subnet interface {
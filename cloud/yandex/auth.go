@@ -0,0 +1,78 @@
+package yandex
+
+import (
+	"context"
+	"errors"
+	ycsdk "github.com/yandex-cloud/go-sdk"
+	"github.com/yandex-cloud/go-sdk/iamkey"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"ya-ansible-inventory/config"
+)
+
+// tokenRefreshMargin is time before IAM token expiration when token is refreshed
+const tokenRefreshMargin = 5 * time.Minute
+
+var (
+	errNoCredentials = errors.New("You must set one of this ENVs: YC_SERVICE_ACCOUNT_KEY_FILE, YC_TOKEN, YC_METADATA_CREDENTIALS")
+	// CredentialsRequirement is satisfied by any supported credentials source
+	CredentialsRequirement = config.Requirement{"YC_SERVICE_ACCOUNT_KEY_FILE", "YC_TOKEN", "YC_METADATA_CREDENTIALS"}
+)
+
+// Requirements are settings of Yandex Cloud inventory
+func Requirements() []config.Requirement {
+	return []config.Requirement{{"FOLDER_ID"}, CredentialsRequirement}
+}
+
+// CredentialsFromEnv returns first configured credentials: service account authorized key JSON file
+// of YC_SERVICE_ACCOUNT_KEY_FILE, OAuth token of YC_TOKEN or instance service account
+// of metadata service if YC_METADATA_CREDENTIALS is true
+func CredentialsFromEnv() (ycsdk.Credentials, error) {
+	if keyFile := os.Getenv("YC_SERVICE_ACCOUNT_KEY_FILE"); len(keyFile) > 0 {
+		key, err := iamkey.ReadFromJSONFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return ycsdk.ServiceAccountKey(key)
+	}
+	if token := os.Getenv("YC_TOKEN"); len(token) > 0 {
+		return ycsdk.OAuthToken(token), nil
+	}
+	if metadata, _ := strconv.ParseBool(os.Getenv("YC_METADATA_CREDENTIALS")); metadata {
+		return ycsdk.InstanceServiceAccount(), nil
+	}
+	return nil, errNoCredentials
+}
+
+// IAMTokenSource issues IAM tokens by SDK credentials, token is cached until it is close to expiration
+type IAMTokenSource struct {
+	api       *ycsdk.SDK
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewIAMTokenSource(api *ycsdk.SDK) *IAMTokenSource {
+	return &IAMTokenSource{api: api}
+}
+
+// Token returns valid IAM token, it is safe for concurrent use
+func (t *IAMTokenSource) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.token) > 0 && time.Now().Add(tokenRefreshMargin).Before(t.expiresAt) {
+		return t.token, nil
+	}
+	resp, err := t.api.CreateIAMToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.token = resp.GetIamToken()
+	t.expiresAt = time.Now().Add(time.Hour)
+	if exp := resp.GetExpiresAt(); exp != nil {
+		t.expiresAt = time.Unix(exp.GetSeconds(), int64(exp.GetNanos()))
+	}
+	return t.token, nil
+}
@@ -18,13 +18,17 @@ const (
 
 func MakeCloudYandex() (*CloudYandex, error) {
 	ctx := context.TODO()
-	envLabels := []string{"YC_TOKEN", "FOLDER_ID"}
+	envLabels := []string{"FOLDER_ID"}
 	envs, err := common.CheckEnvs(envLabels)
 	if err != nil {
 		return nil, fmt.Errorf("You must set this ENVs: %s", strings.Join(envLabels, ", "))
 	}
+	creds, err := CredentialsFromEnv()
+	if err != nil {
+		return nil, err
+	}
 	client, err := ycsdk.Build(ctx, ycsdk.Config{
-		Credentials: ycsdk.OAuthToken(envs["YC_TOKEN"]),
+		Credentials: creds,
 	})
 	if err != nil {
 		return nil, err
@@ -54,11 +58,24 @@ func (h *HostYandex) GetLabels() map[string]string {
 	return h.Labels
 }
 
+func (h *HostYandex) GetZone() string {
+	return h.ZoneId
+}
+
+func (h *HostYandex) GetInstanceType() string {
+	return h.PlatformId
+}
+
+func (h *HostYandex) GetPrivateDNS() string {
+	return h.Fqdn
+}
+
 func (h *HostYandex) GetInterfaces() cloud.Iface {
-	var pubIfs, priIfs []string
+	var pubIfs, priIfs, subnets []string
 	ifaces := h.NetworkInterfaces
 	for _, i := range ifaces {
-		priIfs = append(priIfs, i.PrimaryV4Address.Address)
+		subnets = append(subnets, i.GetSubnetId())
+		priIfs = append(priIfs, i.GetPrimaryV4Address().GetAddress())
 		if len(i.GetPrimaryV4Address().GetOneToOneNat().GetAddress()) > 0 {
 			pubIfs = append(pubIfs, i.GetPrimaryV4Address().GetOneToOneNat().GetAddress())
 		}
@@ -66,6 +83,7 @@ func (h *HostYandex) GetInterfaces() cloud.Iface {
 	return cloud.Iface{
 		Public:  pubIfs,
 		Private: priIfs,
+		Subnets: subnets,
 	}
 }
 
@@ -148,8 +166,7 @@ func (y *CloudYandex) getInstances() ([]*HostYandex, error) {
 			return nil, err
 		}
 		for _, i := range resp.Instances {
-			h := HostYandex(*i)
-			result = append(result, &h)
+			result = append(result, (*HostYandex)(i))
 		}
 		pageToken = resp.GetNextPageToken()
 		if pageToken == "" {
@@ -190,8 +207,7 @@ func (y *CloudYandex) getVpcs() ([]*VpcYandex, error) {
 			return nil, err
 		}
 		for _, net := range resp.GetNetworks() {
-			n := VpcYandex(*net)
-			result = append(result, &n)
+			result = append(result, (*VpcYandex)(net))
 		}
 		pageToken = resp.GetNextPageToken()
 		if pageToken == "" {
@@ -232,8 +248,7 @@ func (y *CloudYandex) getSubNets() ([]*SubnetYandex, error) {
 			return nil, err
 		}
 		for _, sub := range resp.GetSubnets() {
-			s := SubnetYandex(*sub)
-			result = append(result, &s)
+			result = append(result, (*SubnetYandex)(sub))
 		}
 		pageToken = resp.GetNextPageToken()
 		if pageToken == "" {
@@ -274,8 +289,7 @@ func (y *CloudYandex) getYDBs() ([]*CloudDBYandex, error) {
 			return nil, err
 		}
 		for _, db := range resp.Databases {
-			d := CloudDBYandex(*db)
-			result = append(result, &d)
+			result = append(result, (*CloudDBYandex)(db))
 		}
 		pageToken = resp.GetNextPageToken()
 		if pageToken == "" {
@@ -0,0 +1,65 @@
+package dbCommon
+
+import (
+	"strings"
+	"time"
+)
+
+// Filter selects workspaces, empty fields match any row
+type Filter struct {
+	State         string
+	NamePrefix    string
+	HaMode        *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+}
+
+// Match reports whether row passes filter, date ranges include bounds
+func (f Filter) Match(r WsRow) bool {
+	if len(f.State) > 0 && r.State != f.State {
+		return false
+	}
+	if len(f.NamePrefix) > 0 && !strings.HasPrefix(r.Name, f.NamePrefix) {
+		return false
+	}
+	if f.HaMode != nil && r.HaMode != *f.HaMode {
+		return false
+	}
+	if f.CreatedAfter != nil && r.CreateDate.Before(*f.CreatedAfter) {
+		return false
+	}
+	if f.CreatedBefore != nil && r.CreateDate.After(*f.CreatedBefore) {
+		return false
+	}
+	if f.UpdatedAfter != nil && r.UpdateDate.Before(*f.UpdatedAfter) {
+		return false
+	}
+	if f.UpdatedBefore != nil && r.UpdateDate.After(*f.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// Ranges returns date range bounds by column with comparison operator
+func (f Filter) Ranges() []DateRange {
+	var ranges []DateRange
+	for _, r := range []DateRange{
+		{"create_date", ">=", f.CreatedAfter},
+		{"create_date", "<=", f.CreatedBefore},
+		{"update_date", ">=", f.UpdatedAfter},
+		{"update_date", "<=", f.UpdatedBefore},
+	} {
+		if r.Value != nil {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+type DateRange struct {
+	Column string
+	Op     string
+	Value  *time.Time
+}
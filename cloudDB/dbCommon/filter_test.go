@@ -0,0 +1,80 @@
+package dbCommon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseUpperBound(t *testing.T) {
+	tests := map[string]time.Time{
+		"2023-05-17":                 time.Date(2023, 5, 17, 23, 59, 59, 999999000, time.UTC),
+		"2023-05-17T10:20:30Z":       time.Date(2023, 5, 17, 10, 20, 30, 0, time.UTC),
+		"2023-05-17 00:00:00.000000": time.Date(2023, 5, 17, 0, 0, 0, 0, time.UTC),
+	}
+	for s, want := range tests {
+		got, err := ParseUpperBound(s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseUpperBound(%q) = %s, %v, want %s", s, got, err, want)
+		}
+	}
+	if _, err := ParseUpperBound("tomorrow"); err == nil {
+		t.Error("bad bound is accepted")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	day := time.Date(2023, 5, 17, 0, 0, 0, 0, time.UTC)
+	r := WsRow{
+		Name:       "prod-a",
+		State:      StateReady,
+		HaMode:     true,
+		CreateDate: day.Add(10 * time.Hour),
+		UpdateDate: day.Add(48 * time.Hour),
+	}
+	at := func(s string, upper bool) *time.Time {
+		parse := ParseTime
+		if upper {
+			parse = ParseUpperBound
+		}
+		t, err := parse(s)
+		if err != nil {
+			panic(err)
+		}
+		return &t
+	}
+	yes, no := true, false
+	tests := []struct {
+		name string
+		f    Filter
+		want bool
+	}{
+		{"empty", Filter{}, true},
+		{"state", Filter{State: StateReady}, true},
+		{"other state", Filter{State: StateFailed}, false},
+		{"prefix", Filter{NamePrefix: "prod-"}, true},
+		{"other prefix", Filter{NamePrefix: "dev-"}, false},
+		{"ha", Filter{HaMode: &yes}, true},
+		{"not ha", Filter{HaMode: &no}, false},
+		{"created after day start", Filter{CreatedAfter: at("2023-05-17", false)}, true},
+		{"created after next day", Filter{CreatedAfter: at("2023-05-18", false)}, false},
+		{"created before same day", Filter{CreatedBefore: at("2023-05-17", true)}, true},
+		{"created before previous day", Filter{CreatedBefore: at("2023-05-16", true)}, false},
+		{"created at bound", Filter{CreatedAfter: &r.CreateDate, CreatedBefore: &r.CreateDate}, true},
+		{"updated before same day", Filter{UpdatedBefore: at("2023-05-19", true)}, true},
+		{"updated after", Filter{UpdatedAfter: at("2023-05-20", false)}, false},
+		{"all", Filter{State: StateReady, NamePrefix: "prod", HaMode: &yes, UpdatedAfter: at("2023-05-18", false)}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.f.Match(r); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFilterRanges(t *testing.T) {
+	after, before := time.Now(), time.Now()
+	ranges := Filter{CreatedAfter: &after, UpdatedBefore: &before}.Ranges()
+	if len(ranges) != 2 || ranges[0] != (DateRange{"create_date", ">=", &after}) || ranges[1] != (DateRange{"update_date", "<=", &before}) {
+		t.Errorf("ranges = %+v", ranges)
+	}
+}
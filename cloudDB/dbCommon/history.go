@@ -0,0 +1,24 @@
+package dbCommon
+
+import "time"
+
+// HistoryRow is an audit record of workspace state change
+type HistoryRow struct {
+	Name     string    `json:"name"`
+	Date     time.Time `json:"date"`
+	OldState string    `json:"old_state"`
+	NewState string    `json:"new_state"`
+	Actor    string    `json:"actor"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+func NewHistoryRow(name, oldState, newState string, o Opts) *HistoryRow {
+	return &HistoryRow{
+		Name:     name,
+		Date:     Now(),
+		OldState: oldState,
+		NewState: newState,
+		Actor:    o.Owner,
+		Reason:   o.Reason,
+	}
+}
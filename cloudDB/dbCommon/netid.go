@@ -0,0 +1,84 @@
+package dbCommon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultNetIdMin = 1
+	defaultNetIdMax = 255
+	// Attempts to allocate NetId when concurrent workspace creation takes the same id
+	NetIdAllocAttempts = 5
+)
+
+var (
+	ErrNetIdUsed      = errors.New("NetId already used by another workspace")
+	errNetIdExhausted = errors.New("No free NetId in range")
+	errNetIdRange     = errors.New("Bad NetId range")
+)
+
+// NetIdRange is an inclusive range for automatic NetId allocation
+type NetIdRange struct {
+	Min uint32
+	Max uint32
+}
+
+// NetIdRangeFromEnv reads range from NET_ID_MIN and NET_ID_MAX envs, defaults are used for unset envs
+func NetIdRangeFromEnv() (NetIdRange, error) {
+	r := NetIdRange{Min: defaultNetIdMin, Max: defaultNetIdMax}
+	for env, v := range map[string]*uint32{"NET_ID_MIN": &r.Min, "NET_ID_MAX": &r.Max} {
+		s := os.Getenv(env)
+		if len(s) < 1 {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return r, fmt.Errorf("%w: %s=%s", errNetIdRange, env, s)
+		}
+		*v = uint32(n)
+	}
+	if r.Min > r.Max {
+		return r, fmt.Errorf("%w: %d > %d", errNetIdRange, r.Min, r.Max)
+	}
+	return r, nil
+}
+
+// NetIdGiven tells whether net_id is set in workspace json
+func NetIdGiven(j string) (bool, error) {
+	in := struct {
+		NetId *uint32 `json:"net_id"`
+	}{}
+	err := json.Unmarshal([]byte(j), &in)
+	if err != nil {
+		return false, err
+	}
+	return in.NetId != nil, nil
+}
+
+// CheckNetId returns error if NetId is already used
+func CheckNetId(netId uint32, used []uint32) error {
+	for _, u := range used {
+		if u == netId {
+			return fmt.Errorf("%w: %d", ErrNetIdUsed, netId)
+		}
+	}
+	return nil
+}
+
+// LowestFreeNetId returns the lowest NetId from range which is not used
+func LowestFreeNetId(used []uint32, r NetIdRange) (uint32, error) {
+	usedSet := map[uint32]bool{}
+	for _, u := range used {
+		usedSet[u] = true
+	}
+	for id := uint64(r.Min); id <= uint64(r.Max); id++ {
+		if !usedSet[uint32(id)] {
+			return uint32(id), nil
+		}
+	}
+	return 0, fmt.Errorf("%w %d-%d", errNetIdExhausted, r.Min, r.Max)
+}
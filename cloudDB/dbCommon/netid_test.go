@@ -0,0 +1,84 @@
+package dbCommon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLowestFreeNetId(t *testing.T) {
+	tests := []struct {
+		used []uint32
+		r    NetIdRange
+		want uint32
+		err  bool
+	}{
+		{nil, NetIdRange{1, 255}, 1, false},
+		{[]uint32{1, 2, 4}, NetIdRange{1, 255}, 3, false},
+		{[]uint32{1, 2, 300}, NetIdRange{1, 3}, 3, false},
+		{[]uint32{5, 6}, NetIdRange{5, 6}, 0, true},
+		{nil, NetIdRange{4294967295, 4294967295}, 4294967295, false},
+		{[]uint32{4294967295}, NetIdRange{4294967295, 4294967295}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := LowestFreeNetId(tt.used, tt.r)
+		if (err != nil) != tt.err {
+			t.Errorf("%v in %v: error = %v, want error %v", tt.used, tt.r, err, tt.err)
+		}
+		if got != tt.want {
+			t.Errorf("%v in %v = %d, want %d", tt.used, tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestCheckNetId(t *testing.T) {
+	if err := CheckNetId(3, []uint32{1, 2}); err != nil {
+		t.Error(err)
+	}
+	if err := CheckNetId(2, []uint32{1, 2}); !errors.Is(err, ErrNetIdUsed) {
+		t.Errorf("used NetId error = %v", err)
+	}
+}
+
+func TestNetIdGiven(t *testing.T) {
+	tests := map[string]bool{
+		`{"name":"a"}`:               false,
+		`{"name":"a","net_id":0}`:    true,
+		`{"name":"a","net_id":7}`:    true,
+		`{"name":"a","net_id":null}`: false,
+	}
+	for j, want := range tests {
+		got, err := NetIdGiven(j)
+		if err != nil || got != want {
+			t.Errorf("NetIdGiven(%s) = %v, %v, want %v", j, got, err, want)
+		}
+	}
+	if _, err := NetIdGiven(`{`); err == nil {
+		t.Error("bad JSON is accepted")
+	}
+}
+
+func TestNetIdRangeFromEnv(t *testing.T) {
+	tests := []struct {
+		min, max string
+		want     NetIdRange
+		err      bool
+	}{
+		{"", "", NetIdRange{defaultNetIdMin, defaultNetIdMax}, false},
+		{"10", "", NetIdRange{10, defaultNetIdMax}, false},
+		{"10", "20", NetIdRange{10, 20}, false},
+		{"20", "10", NetIdRange{}, true},
+		{"x", "", NetIdRange{}, true},
+		{"", "-1", NetIdRange{}, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("NET_ID_MIN", tt.min)
+		t.Setenv("NET_ID_MAX", tt.max)
+		got, err := NetIdRangeFromEnv()
+		if (err != nil) != tt.err {
+			t.Errorf("%q-%q: error = %v, want error %v", tt.min, tt.max, err, tt.err)
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("%q-%q = %v, want %v", tt.min, tt.max, got, tt.want)
+		}
+	}
+}
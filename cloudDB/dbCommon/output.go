@@ -0,0 +1,90 @@
+package dbCommon
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"ya-ansible-inventory/common"
+)
+
+// Workspace list output formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+var wsHeader = []string{"name", "net_id", "state", "ha_mode", "version", "create_date", "update_date", "lock_owner", "lock_expire"}
+
+// WriteRows writes rows sorted by name in given format
+func WriteRows(w io.Writer, rows []WsRow, format string) error {
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+	switch format {
+	case FormatJSON, "":
+		if rows == nil {
+			rows = []WsRow{}
+		}
+		s, err := common.StringDumpErr(rows)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, s)
+		return err
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, r := range rows {
+			err := enc.Encode(r)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		err := cw.Write(wsHeader)
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			err = cw.Write(wsRecord(r))
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(wsHeader, "\t")))
+		for _, r := range rows {
+			fmt.Fprintln(tw, strings.Join(wsRecord(r), "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("Unknown output format: %s", format)
+	}
+}
+
+func wsRecord(r WsRow) []string {
+	lockExpire := ""
+	if r.LockExpire != nil {
+		lockExpire = FormatTime(*r.LockExpire)
+	}
+	return []string{
+		r.Name,
+		strconv.FormatUint(uint64(r.NetId), 10),
+		r.State,
+		strconv.FormatBool(r.HaMode),
+		strconv.FormatUint(r.Version, 10),
+		FormatTime(r.CreateDate),
+		FormatTime(r.UpdateDate),
+		r.LockOwner,
+		lockExpire,
+	}
+}
@@ -0,0 +1,58 @@
+package dbCommon
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion is the newest registry schema this binary understands.
+// 1 - workspace table of the first releases, 2 - versions, locks and history,
+// 3 - index on workspace state
+const SchemaVersion uint32 = 3
+
+var (
+	ErrSchemaNewer = errors.New("Registry schema is newer than this binary supports, upgrade the binary")
+	ErrSchemaOlder = errors.New("Registry schema is outdated, run --db-migrate")
+)
+
+// Migration upgrades registry schema from Version-1 to Version
+type Migration struct {
+	Version uint32
+	Name    string
+	Apply   func() error
+}
+
+// CheckSchema checks registry schema version, 0 means registry is not created yet
+func CheckSchema(version uint32) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: %d > %d", ErrSchemaNewer, version, SchemaVersion)
+	}
+	if version > 0 && version < SchemaVersion {
+		return fmt.Errorf("%w: %d < %d", ErrSchemaOlder, version, SchemaVersion)
+	}
+	return nil
+}
+
+// Migrate applies migrations newer than version in order and returns applied ones,
+// schema version marker is stored after every applied migration
+func Migrate(version uint32, migrations []Migration, setVersion func(uint32) error) ([]Migration, error) {
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("%w: %d > %d", ErrSchemaNewer, version, SchemaVersion)
+	}
+	var applied []Migration
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		err := m.Apply()
+		if err != nil {
+			return applied, fmt.Errorf("Migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		err = setVersion(m.Version)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
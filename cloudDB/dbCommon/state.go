@@ -0,0 +1,99 @@
+package dbCommon
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Workspace lifecycle states
+const (
+	StateCreating   = "creating"
+	StateReady      = "ready"
+	StateUpdating   = "updating"
+	StateDestroying = "destroying"
+	StateDestroyed  = "destroyed"
+	StateFailed     = "failed"
+)
+
+// Pseudo states recorded in history when workspace row is removed
+const (
+	StateDeleted  = "deleted"
+	StateArchived = "archived"
+)
+
+var (
+	ErrWsNotFound   = errors.New("Workspace not found")
+	ErrWsExists     = errors.New("Workspace already exists")
+	ErrVersion      = errors.New("Workspace was modified concurrently, version mismatch")
+	ErrLocked       = errors.New("Workspace locked")
+	ErrOwner        = errors.New("Lock owner not set")
+	errBadState     = errors.New("Unknown workspace state")
+	errNotDestroyed = errors.New("Workspace is not destroyed")
+)
+
+// Allowed transitions: creating -> ready -> updating -> ready -> destroying -> destroyed, any alive state may fail
+var transitions = map[string][]string{
+	StateCreating:   {StateReady, StateFailed},
+	StateReady:      {StateUpdating, StateDestroying, StateFailed},
+	StateUpdating:   {StateReady, StateFailed},
+	StateDestroying: {StateDestroyed, StateFailed},
+	StateDestroyed:  {},
+	StateFailed:     {StateUpdating, StateDestroying},
+}
+
+// Opts modify behaviour of state changing operations
+type Opts struct {
+	Force  bool
+	Owner  string
+	Reason string
+}
+
+func IsState(s string) bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// CheckTransition returns error if workspace can't go from state "from" to state "to".
+// Force skips transition check, but target state must be known anyway.
+func CheckTransition(from, to string, force bool) error {
+	if !IsState(to) {
+		return fmt.Errorf("%w: %q", errBadState, to)
+	}
+	if force {
+		return nil
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid state transition %q -> %q, use force to override", from, to)
+}
+
+// CheckLock returns error if workspace is held by another owner and lease is not expired yet
+func CheckLock(lockOwner string, lockExpire *time.Time, o Opts) error {
+	if o.Force || len(lockOwner) < 1 || lockOwner == o.Owner {
+		return nil
+	}
+	if lockExpire == nil || lockExpire.Before(time.Now()) {
+		return nil
+	}
+	return fmt.Errorf("%w by %q until %s", ErrLocked, lockOwner, lockExpire.Format(time.RFC3339))
+}
+
+// CheckVersion returns error if caller expects another version of workspace row, zero means any version
+func CheckVersion(expected, current uint64) error {
+	if expected != 0 && expected != current {
+		return fmt.Errorf("%w: expected %d, current %d", ErrVersion, expected, current)
+	}
+	return nil
+}
+
+// CheckRemove returns error if workspace in state can't be deleted or archived
+func CheckRemove(state string, force bool) error {
+	if force || state == StateDestroyed {
+		return nil
+	}
+	return fmt.Errorf("%w: state is %q, use force to override", errNotDestroyed, state)
+}
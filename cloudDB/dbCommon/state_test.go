@@ -0,0 +1,101 @@
+package dbCommon
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		force    bool
+		err      bool
+	}{
+		{StateCreating, StateReady, false, false},
+		{StateCreating, StateFailed, false, false},
+		{StateCreating, StateUpdating, false, true},
+		{StateReady, StateUpdating, false, false},
+		{StateReady, StateDestroying, false, false},
+		{StateReady, StateCreating, false, true},
+		{StateUpdating, StateReady, false, false},
+		{StateDestroying, StateDestroyed, false, false},
+		{StateDestroying, StateReady, false, true},
+		{StateDestroyed, StateReady, false, true},
+		{StateDestroyed, StateReady, true, false},
+		{StateFailed, StateUpdating, false, false},
+		{StateFailed, StateReady, false, true},
+		{StateReady, "nosuch", false, true},
+		{StateReady, "nosuch", true, true},
+		{"", StateReady, false, true},
+	}
+	for _, tt := range tests {
+		err := CheckTransition(tt.from, tt.to, tt.force)
+		if (err != nil) != tt.err {
+			t.Errorf("%q -> %q force %v: error = %v, want error %v", tt.from, tt.to, tt.force, err, tt.err)
+		}
+	}
+}
+
+func TestCheckLock(t *testing.T) {
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	tests := []struct {
+		name   string
+		owner  string
+		expire *time.Time
+		o      Opts
+		err    bool
+	}{
+		{"not locked", "", nil, Opts{Owner: "bob"}, false},
+		{"same owner", "alice", &future, Opts{Owner: "alice"}, false},
+		{"other owner", "alice", &future, Opts{Owner: "bob"}, true},
+		{"no owner", "alice", &future, Opts{}, true},
+		{"expired", "alice", &past, Opts{Owner: "bob"}, false},
+		{"no expire", "alice", nil, Opts{Owner: "bob"}, false},
+		{"force", "alice", &future, Opts{Owner: "bob", Force: true}, false},
+	}
+	for _, tt := range tests {
+		err := CheckLock(tt.owner, tt.expire, tt.o)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.err)
+		}
+		if err != nil && !errors.Is(err, ErrLocked) {
+			t.Errorf("%s: error is not ErrLocked: %v", tt.name, err)
+		}
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		expected, current uint64
+		err               bool
+	}{
+		{0, 5, false},
+		{5, 5, false},
+		{4, 5, true},
+		{6, 5, true},
+	}
+	for _, tt := range tests {
+		err := CheckVersion(tt.expected, tt.current)
+		if (err != nil) != tt.err {
+			t.Errorf("expected %d current %d: error = %v, want error %v", tt.expected, tt.current, err, tt.err)
+		}
+		if err != nil && !errors.Is(err, ErrVersion) {
+			t.Errorf("error is not ErrVersion: %v", err)
+		}
+	}
+}
+
+func TestCheckRemove(t *testing.T) {
+	for _, s := range []string{StateCreating, StateReady, StateUpdating, StateDestroying, StateFailed} {
+		if err := CheckRemove(s, false); err == nil {
+			t.Errorf("workspace in state %s is removable", s)
+		}
+		if err := CheckRemove(s, true); err != nil {
+			t.Errorf("forced remove in state %s: %v", s, err)
+		}
+	}
+	if err := CheckRemove(StateDestroyed, false); err != nil {
+		t.Errorf("destroyed workspace is not removable: %v", err)
+	}
+}
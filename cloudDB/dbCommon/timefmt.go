@@ -0,0 +1,94 @@
+package dbCommon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeLayout is canonical text encoding of registry timestamps: UTC with microsecond precision
+const TimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+var (
+	errBadTime = errors.New("Unsupported timestamp format")
+	// timeLayouts are accepted on read, older releases wrote time.Time.String() and RFC3339
+	timeLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05.999999999 -0700 MST",
+		"2006-01-02 15:04:05.999999999 -0700",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02",
+	}
+)
+
+// Now returns current time in canonical form
+func Now() time.Time {
+	return CanonicalTime(time.Now())
+}
+
+// CanonicalTime returns t in UTC truncated to microseconds, monotonic clock reading is dropped
+func CanonicalTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func FormatTime(t time.Time) string {
+	return CanonicalTime(t).Format(TimeLayout)
+}
+
+// ParseTime parses canonical and legacy timestamps, unix epoch numbers are accepted
+// in seconds, milliseconds or microseconds
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	// time.Time.String() appends monotonic clock reading
+	if i := strings.Index(s, " m="); i > 0 {
+		s = s[:i]
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n < 1e11:
+			return CanonicalTime(time.Unix(n, 0)), nil
+		case n < 1e14:
+			return CanonicalTime(time.Unix(0, n*int64(time.Millisecond))), nil
+		default:
+			return CanonicalTime(time.Unix(0, n*int64(time.Microsecond))), nil
+		}
+	}
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return CanonicalTime(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %q", errBadTime, s)
+}
+
+// ParseUpperBound parses inclusive upper bound of date range, date without time
+// is the last microsecond of that day
+func ParseUpperBound(s string) (time.Time, error) {
+	t, err := ParseTime(s)
+	if err != nil {
+		return t, err
+	}
+	if _, err := time.Parse("2006-01-02", strings.TrimSpace(s)); err == nil {
+		t = t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return t, nil
+}
+
+// CanonicalRow converts row timestamps to canonical form, reports whether row is changed
+func CanonicalRow(r *WsRow) bool {
+	changed := false
+	for _, t := range []*time.Time{&r.CreateDate, &r.UpdateDate, r.LockExpire} {
+		if t == nil {
+			continue
+		}
+		c := CanonicalTime(*t)
+		if !c.Equal(*t) || t.Location() != time.UTC {
+			changed = true
+		}
+		*t = c
+	}
+	return changed
+}
@@ -0,0 +1,70 @@
+package dbCommon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2023, 5, 17, 10, 20, 30, 123456000, time.UTC)
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"2023-05-17T10:20:30.123456Z", want},
+		{"2023-05-17T13:20:30.123456789+03:00", want},
+		{"2023-05-17 10:20:30.123456789 +0000 UTC", want},
+		{"2023-05-17 13:20:30.123456 +0300 MSK m=+0.001", want},
+		{"2023-05-17 10:20:30.123456", want},
+		{" 2023-05-17T10:20:30.123456Z ", want},
+		{"2023-05-17", time.Date(2023, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{"1684318830", want.Truncate(time.Second)},
+		{"1684318830123", want.Truncate(time.Millisecond)},
+		{"1684318830123456", want},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.s)
+		if err != nil {
+			t.Errorf("ParseTime(%q): %v", tt.s, err)
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("ParseTime(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+	for _, s := range []string{"", "yesterday", "17.05.2023", "2023-13-01"} {
+		if _, err := ParseTime(s); err == nil {
+			t.Errorf("ParseTime(%q) is accepted", s)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	ts := time.Date(2023, 5, 17, 13, 20, 30, 123456789, time.FixedZone("MSK", 3*3600))
+	s := FormatTime(ts)
+	if s != "2023-05-17T10:20:30.123456Z" {
+		t.Errorf("FormatTime = %s", s)
+	}
+	back, err := ParseTime(s)
+	if err != nil || !back.Equal(CanonicalTime(ts)) {
+		t.Errorf("ParseTime(FormatTime) = %s, %v", back, err)
+	}
+}
+
+func TestCanonicalRow(t *testing.T) {
+	lock := time.Date(2023, 5, 17, 13, 0, 0, 999, time.FixedZone("MSK", 3*3600))
+	r := WsRow{
+		CreateDate: time.Date(2023, 5, 17, 10, 0, 0, 0, time.UTC),
+		UpdateDate: time.Date(2023, 5, 17, 10, 0, 0, 1500, time.UTC),
+		LockExpire: &lock,
+	}
+	if !CanonicalRow(&r) {
+		t.Error("row is not changed")
+	}
+	if r.UpdateDate.Nanosecond() != 1000 || r.LockExpire.Location() != time.UTC || r.LockExpire.Nanosecond() != 0 {
+		t.Errorf("row = %+v", r)
+	}
+	if CanonicalRow(&r) {
+		t.Error("canonical row is changed")
+	}
+}
@@ -0,0 +1,16 @@
+package dbCommon
+
+import "time"
+
+// WsRow is a workspace registry row, the same for all backends
+type WsRow struct {
+	Name       string     `json:"name"`
+	NetId      uint32     `json:"net_id"`
+	CreateDate time.Time  `json:"create_date"`
+	UpdateDate time.Time  `json:"update_date"`
+	State      string     `json:"state"`
+	HaMode     bool       `json:"ha_mode"`
+	Version    uint64     `json:"version"`
+	LockOwner  string     `json:"lock_owner,omitempty"`
+	LockExpire *time.Time `json:"lock_expire,omitempty"`
+}
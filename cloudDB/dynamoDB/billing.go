@@ -0,0 +1,55 @@
+package dynamoDB
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"os"
+	"strconv"
+)
+
+// Billing is capacity mode of created tables and indexes
+type Billing struct {
+	Mode          types.BillingMode
+	ReadCapacity  int64
+	WriteCapacity int64
+}
+
+// billingFromEnv reads DDB_BILLING_MODE (PROVISIONED by default or PAY_PER_REQUEST)
+// with DDB_READ_CAPACITY and DDB_WRITE_CAPACITY units of provisioned mode, 1 by default
+func billingFromEnv() (Billing, error) {
+	b := Billing{Mode: types.BillingModeProvisioned, ReadCapacity: 1, WriteCapacity: 1}
+	if mode := os.Getenv("DDB_BILLING_MODE"); len(mode) > 0 {
+		b.Mode = types.BillingMode(mode)
+	}
+	if b.Mode != types.BillingModeProvisioned && b.Mode != types.BillingModePayPerRequest {
+		return b, fmt.Errorf("DDB_BILLING_MODE must be %s or %s", types.BillingModeProvisioned, types.BillingModePayPerRequest)
+	}
+	for env, dst := range map[string]*int64{"DDB_READ_CAPACITY": &b.ReadCapacity, "DDB_WRITE_CAPACITY": &b.WriteCapacity} {
+		v := os.Getenv(env)
+		if len(v) < 1 {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return b, fmt.Errorf("%s must be positive number: %q", env, v)
+		}
+		*dst = n
+	}
+	return b, nil
+}
+
+// throughput returns nil for on-demand tables
+func (b Billing) throughput() *types.ProvisionedThroughput {
+	if b.Mode == types.BillingModePayPerRequest {
+		return nil
+	}
+	return b.provisioned()
+}
+
+func (b Billing) provisioned() *types.ProvisionedThroughput {
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(b.ReadCapacity),
+		WriteCapacityUnits: aws.Int64(b.WriteCapacity),
+	}
+}
@@ -5,11 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	awsSess "github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"os"
 	"strings"
 	"time"
-	"ya-ansible-inventory/cloud"
+	cloudAWS "ya-ansible-inventory/cloud/aws"
+	"ya-ansible-inventory/cloudDB/dbCommon"
 	"ya-ansible-inventory/common"
 )
 
@@ -18,35 +19,73 @@ var (
 	errSetState   = errors.New("Set state. Must set ws Name and ws State")
 )
 
-func MakeCloudDBAWS(cl cloud.Cloud) (*dynamoDB, error) {
+// MakeCloudDBAWS connects to DynamoDB tables named by AWS_TABLE env in DDB_REGION region,
+// default region of shared config is used if DDB_REGION is not set
+func MakeCloudDBAWS() (*dynamoDB, error) {
 	envLabels := []string{"AWS_TABLE"}
 	envs, err := common.CheckEnvs(envLabels)
 	if err != nil {
 		return nil, fmt.Errorf("You must set this ENVs: %s", strings.Join(envLabels, ", "))
 	}
-	sess, err := awsSess.NewSessionWithOptions(awsSess.Options{
-		SharedConfigState: awsSess.SharedConfigEnable,
-	})
+	// Config is loaded the same way as for EC2 inventory
+	cfg, err := cloudAWS.LoadConfig(context.TODO(), cloudAWS.StateRegion(os.Getenv("DDB_REGION")))
+	if err != nil {
+		return nil, err
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	netIds, err := dbCommon.NetIdRangeFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	billing, err := billingFromEnv()
 	if err != nil {
 		return nil, err
 	}
-	// Create DynamoDB client
-	client := dynamodb.New(sess)
 	conn := &DDBConn{
-		TableName: envs["AWS_TABLE"],
-		CTX:       context.Background(),
-		client:    client,
+		TableName:        envs["AWS_TABLE"],
+		HistoryTableName: auxTableName("AWS_HISTORY_TABLE", envs["AWS_TABLE"], "_history"),
+		ArchiveTableName: auxTableName("AWS_ARCHIVE_TABLE", envs["AWS_TABLE"], "_archive"),
+		NetIdTableName:   auxTableName("AWS_NETID_TABLE", envs["AWS_TABLE"], "_netid"),
+		MetaTableName:    auxTableName("AWS_META_TABLE", envs["AWS_TABLE"], "_meta"),
+		Billing:          billing,
+		NetIds:           netIds,
+		CTX:              context.Background(),
+		client:           client,
 	}
 	return &dynamoDB{api: client, conn: conn}, nil
 }
 
+// auxTableName returns table name from env or main table name with suffix
+func auxTableName(env, mainTable, suffix string) string {
+	if name := os.Getenv(env); len(name) > 0 {
+		return name
+	}
+	return mainTable + suffix
+}
+
 type dynamoDB struct {
-	api  *dynamodb.DynamoDB
+	api  *dynamodb.Client
 	conn *DDBConn
 }
 
-func (d dynamoDB) List() error {
-	r, err := d.conn.Select(nil)
+func (d dynamoDB) List(f dbCommon.Filter, format string) error {
+	r, err := d.Find(f)
+	if err != nil {
+		return err
+	}
+	return dbCommon.WriteRows(os.Stdout, r, format)
+}
+
+func (d dynamoDB) Find(f dbCommon.Filter) ([]dbCommon.WsRow, error) {
+	r, err := d.conn.Find(f)
+	if err != nil {
+		return nil, err
+	}
+	return *r, nil
+}
+
+func (d dynamoDB) History(name string) error {
+	r, err := d.conn.SelectHistory(name)
 	if err != nil {
 		return err
 	}
@@ -58,24 +97,40 @@ func (d dynamoDB) List() error {
 	return nil
 }
 
-func (d dynamoDB) Create(s string) error {
-	inRow := WsRow{}
+func (d dynamoDB) Create(s string, o dbCommon.Opts) error {
+	inRow := dbCommon.WsRow{}
 	err := json.Unmarshal([]byte(s), &inRow)
 	if err != nil {
 		return err
 	}
-	inRow.State = "creating"
-	inRow.CreateDate = time.Now()
-	inRow.UpdateDate = time.Now()
+	inRow.State = dbCommon.StateCreating
+	inRow.CreateDate = dbCommon.Now()
+	inRow.UpdateDate = dbCommon.Now()
+	inRow.Version = 1
+	inRow.LockOwner = ""
+	inRow.LockExpire = nil
 	err = d.conn.CreateTable()
 	if err != nil {
 		return err
 	}
-	return d.conn.Insert(inRow)
+	netIdGiven, err := dbCommon.NetIdGiven(s)
+	if err != nil {
+		return err
+	}
+	err = d.conn.Insert(&inRow, !netIdGiven, dbCommon.NewHistoryRow(inRow.Name, "", inRow.State, o))
+	if err != nil {
+		return err
+	}
+	out, err := common.StringDumpErr(inRow)
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
 }
 
-func (d dynamoDB) SetState(s string) error {
-	inRow := WsRow{}
+func (d dynamoDB) SetState(s string, o dbCommon.Opts) error {
+	inRow := dbCommon.WsRow{}
 	err := json.Unmarshal([]byte(s), &inRow)
 	if err != nil {
 		return err
@@ -83,21 +138,131 @@ func (d dynamoDB) SetState(s string) error {
 	if len(inRow.Name) < 1 || len(inRow.State) < 1 {
 		return errSetState
 	}
-	return d.conn.Set(inRow.Name, inRow.State)
+	cur, err := d.conn.Get(inRow.Name)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckVersion(inRow.Version, cur.Version)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckTransition(cur.State, inRow.State, o.Force)
+	if err != nil {
+		return err
+	}
+	return d.conn.Set(inRow.Name, cur.Version, map[string]interface{}{
+		"state": inRow.State,
+	}, dbCommon.NewHistoryRow(inRow.Name, cur.State, inRow.State, o))
+}
+
+func (d dynamoDB) Lock(name string, ttl time.Duration, o dbCommon.Opts) error {
+	if len(o.Owner) < 1 {
+		return dbCommon.ErrOwner
+	}
+	cur, err := d.conn.Get(name)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	return d.conn.Set(name, cur.Version, map[string]interface{}{
+		"lock_owner":  o.Owner,
+		"lock_expire": dbCommon.Now().Add(ttl),
+	}, nil)
 }
 
+func (d dynamoDB) Unlock(name string, o dbCommon.Opts) error {
+	cur, err := d.conn.Get(name)
+	if err != nil {
+		return err
+	}
+	if len(cur.LockOwner) < 1 {
+		return nil
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	return d.conn.Set(name, cur.Version, map[string]interface{}{
+		"lock_owner":  nil,
+		"lock_expire": nil,
+	}, nil)
+}
+
+// Close does nothing: DynamoDB client keeps no open connections
 func (d dynamoDB) Close() {
-	//if d.conn != nil {
-	//	d.conn.Close()
-	//	d.conn = nil
-	//}
-}
-
-type WsRow struct {
-	Name       string    `json:"name"`
-	NetId      uint32    `json:"net_id"`
-	CreateDate time.Time `json:"create_date"`
-	UpdateDate time.Time `json:"update_date"`
-	State      string    `json:"state"`
-	HaMode     bool      `json:"ha_mode"`
+}
+
+func (d dynamoDB) Delete(name string, o dbCommon.Opts) error {
+	cur, err := d.conn.Get(name)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckRemove(cur.State, o.Force)
+	if err != nil {
+		return err
+	}
+	return d.conn.Delete(*cur, dbCommon.NewHistoryRow(name, cur.State, dbCommon.StateDeleted, o))
+}
+
+func (d dynamoDB) Archive(name string, o dbCommon.Opts) error {
+	cur, err := d.conn.Get(name)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckRemove(cur.State, o.Force)
+	if err != nil {
+		return err
+	}
+	err = d.conn.CreateArchiveTable()
+	if err != nil {
+		return err
+	}
+	return d.conn.Archive(*cur, dbCommon.NewHistoryRow(name, cur.State, dbCommon.StateArchived, o))
+}
+
+func (d dynamoDB) Dump() ([]dbCommon.WsRow, []dbCommon.HistoryRow, error) {
+	rows, err := d.conn.Select(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	history, err := d.conn.SelectHistory("")
+	if err != nil {
+		return nil, nil, err
+	}
+	return *rows, *history, nil
+}
+
+func (d dynamoDB) Restore(r *dbCommon.WsRow, history []dbCommon.HistoryRow, overwrite bool) error {
+	err := d.conn.CreateTable()
+	if err != nil {
+		return err
+	}
+	return d.conn.Restore(r, history, overwrite)
+}
+
+func (d dynamoDB) SchemaVersion() (uint32, error) {
+	return d.conn.SchemaVersion()
+}
+
+func (d dynamoDB) Migrate() ([]dbCommon.Migration, error) {
+	return d.conn.Migrate()
+}
+
+func (d dynamoDB) RepairDates() (int, error) {
+	return d.conn.RepairDates()
 }
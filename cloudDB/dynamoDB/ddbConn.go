@@ -2,137 +2,558 @@ package dynamoDB
 
 import (
 	"context"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strings"
 	"time"
+	"ya-ansible-inventory/cloudDB/dbCommon"
 )
 
+// tableWaitTimeout limits waiting for created table to become ACTIVE
+const tableWaitTimeout = 5 * time.Minute
+
 type DDBConn struct {
-	TableName string
-	CTX       context.Context
-	client    *dynamodb.DynamoDB
+	TableName        string
+	HistoryTableName string
+	ArchiveTableName string
+	NetIdTableName   string
+	MetaTableName    string
+	Billing          Billing
+	NetIds           dbCommon.NetIdRange
+	CTX              context.Context
+	client           *dynamodb.Client
 }
 
+// CreateTable creates registry tables of current schema version if registry does not exist
 func (dd *DDBConn) CreateTable() error {
-	// Check table exists
-	inputD := dynamodb.DescribeTableInput{TableName: &dd.TableName}
-	_, err := dd.client.DescribeTable(&inputD)
-	if err == nil {
-		return nil
+	version, err := dd.SchemaVersion()
+	if err != nil || version > 0 {
+		return err
 	}
-	if awsErr, ok := err.(awserr.Error); ok {
-		if awsErr.Code() != dynamodb.ErrCodeResourceNotFoundException {
-			return err
-		}
-	} else {
+	err = dd.createTable(dd.TableName, map[string]string{"name": "S", "state": "S"}, []string{"name"}, dd.stateIndex())
+	if err != nil {
+		return err
+	}
+	err = dd.createAuxTables()
+	if err != nil {
+		return err
+	}
+	return dd.SetSchemaVersion(dbCommon.SchemaVersion)
+}
+
+func (dd *DDBConn) createAuxTables() error {
+	err := dd.createTable(dd.HistoryTableName, map[string]string{"name": "S", "ts": "N"}, []string{"name", "ts"})
+	if err != nil {
+		return err
+	}
+	err = dd.createTable(dd.NetIdTableName, map[string]string{"net_id": "N"}, []string{"net_id"})
+	if err != nil {
+		return err
+	}
+	return dd.createTable(dd.MetaTableName, map[string]string{"name": "S"}, []string{"name"})
+}
+
+func (dd *DDBConn) CreateArchiveTable() error {
+	return dd.createTable(dd.ArchiveTableName, map[string]string{"name": "S", "archive_ts": "N"}, []string{"name", "archive_ts"})
+}
+
+// createTable creates table if not exists, keys are hash key and optional range key
+func (dd *DDBConn) createTable(tableName string, attrs map[string]string, keys []string, indexes ...types.GlobalSecondaryIndex) error {
+	// Check table exists, table created by concurrent run may be not ready yet
+	desc, err := dd.describeTable(tableName)
+	if err == nil && desc.TableStatus == types.TableStatusCreating {
+		return dd.waitActive(tableName)
+	}
+	if err != errTableNotFound {
 		return err
 	}
 	// Create table if not exists
+	var attrDefs []types.AttributeDefinition
+	for n, t := range attrs {
+		attrDefs = append(attrDefs, types.AttributeDefinition{
+			AttributeName: aws.String(n),
+			AttributeType: types.ScalarAttributeType(t),
+		})
+	}
+	var keySchema []types.KeySchemaElement
+	for i, k := range keys {
+		keyType := types.KeyTypeHash
+		if i > 0 {
+			keyType = types.KeyTypeRange
+		}
+		keySchema = append(keySchema, types.KeySchemaElement{
+			AttributeName: aws.String(k),
+			KeyType:       keyType,
+		})
+	}
 	input := &dynamodb.CreateTableInput{
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
-			{
-				AttributeName: aws.String("name"),
-				AttributeType: aws.String("S"),
-			},
-		},
-		KeySchema: []*dynamodb.KeySchemaElement{
-			{
-				AttributeName: aws.String("name"),
-				KeyType:       aws.String("HASH"),
+		AttributeDefinitions:  attrDefs,
+		KeySchema:             keySchema,
+		BillingMode:           dd.Billing.Mode,
+		ProvisionedThroughput: dd.Billing.throughput(),
+		TableName:             aws.String(tableName),
+	}
+	if len(indexes) > 0 {
+		input.GlobalSecondaryIndexes = indexes
+	}
+	_, err = dd.client.CreateTable(dd.CTX, input)
+	if err != nil {
+		return err
+	}
+	return dd.waitActive(tableName)
+}
+
+// waitActive waits until table becomes ACTIVE, writes to creating table fail
+func (dd *DDBConn) waitActive(tableName string) error {
+	return dynamodb.NewTableExistsWaiter(dd.client).Wait(dd.CTX, &dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	}, tableWaitTimeout)
+}
+
+// Select returns rows with fields equal to w values, all pages of scan are read
+func (dd *DDBConn) Select(w map[string]interface{}) (*[]dbCommon.WsRow, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(dd.TableName),
+	}
+	if len(w) > 0 {
+		names := map[string]string{}
+		values := map[string]types.AttributeValue{}
+		var conds []string
+		n := 0
+		for k, v := range w {
+			n++
+			av, err := marshalValue(v)
+			if err != nil {
+				return nil, err
+			}
+			names[fmt.Sprintf("#w%d", n)] = k
+			values[fmt.Sprintf(":w%d", n)] = av
+			conds = append(conds, fmt.Sprintf("#w%d = :w%d", n, n))
+		}
+		input.FilterExpression = aws.String(strings.Join(conds, " AND "))
+		input.ExpressionAttributeNames = names
+		input.ExpressionAttributeValues = values
+	}
+	items, err := dd.scan(input)
+	if err != nil {
+		return nil, err
+	}
+	return wsFromItems(items)
+}
+
+// scan reads all pages of scan
+func (dd *DDBConn) scan(input *dynamodb.ScanInput) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	p := dynamodb.NewScanPaginator(dd.client, input)
+	for p.HasMorePages() {
+		page, err := p.NextPage(dd.CTX)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+// query reads all pages of query
+func (dd *DDBConn) query(input *dynamodb.QueryInput) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	p := dynamodb.NewQueryPaginator(dd.client, input)
+	for p.HasMorePages() {
+		page, err := p.NextPage(dd.CTX)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+func (dd *DDBConn) Get(name string) (*dbCommon.WsRow, error) {
+	input := &dynamodb.GetItemInput{
+		Key:            wsKey(name),
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(dd.TableName),
+	}
+	res, err := dd.client.GetItem(dd.CTX, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Item) < 1 {
+		return nil, dbCommon.ErrWsNotFound
+	}
+	return wsFromItem(res.Item)
+}
+
+// Insert adds new row, NetId is checked for duplicates or allocated from NetIds range if autoNetId is set.
+// NetId is claimed in NetId table in the same transaction with row and history record
+func (dd *DDBConn) Insert(r *dbCommon.WsRow, autoNetId bool, h *dbCommon.HistoryRow) error {
+	for i := 0; i < dbCommon.NetIdAllocAttempts; i++ {
+		used, err := dd.usedNetIds()
+		if err != nil {
+			return err
+		}
+		if autoNetId {
+			r.NetId, err = dbCommon.LowestFreeNetId(used, dd.NetIds)
+		} else {
+			err = dbCommon.CheckNetId(r.NetId, used)
+		}
+		if err != nil {
+			return err
+		}
+		claim := &types.Put{
+			Item:                netIdItem(r),
+			ConditionExpression: aws.String("attribute_not_exists(net_id)"),
+			TableName:           aws.String(dd.NetIdTableName),
+		}
+		put := &types.Put{
+			Item:                wsItem(r),
+			ConditionExpression: aws.String("attribute_not_exists(#N)"),
+			ExpressionAttributeNames: map[string]string{
+				"#N": "name",
 			},
+			TableName: aws.String(dd.TableName),
+		}
+		err = dd.write([]types.TransactWriteItem{{Put: claim}, {Put: put}}, h)
+		failed := conditionFailed(err)
+		if len(failed) < 1 {
+			return err
+		}
+		if failed[1] {
+			return dbCommon.ErrWsExists
+		}
+		if !autoNetId {
+			return fmt.Errorf("%w: %d", dbCommon.ErrNetIdUsed, r.NetId)
+		}
+	}
+	return fmt.Errorf("%w: allocation attempts exceeded", dbCommon.ErrNetIdUsed)
+}
+
+// Restore writes row as is with its NetId claim and history records.
+// Row may be nil to write history records only
+func (dd *DDBConn) Restore(r *dbCommon.WsRow, history []dbCommon.HistoryRow, overwrite bool) error {
+	if r != nil {
+		err := dd.restoreRow(r, overwrite)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range history {
+		p := dd.historyPut(&history[i])
+		_, err := dd.client.PutItem(dd.CTX, &dynamodb.PutItemInput{
+			Item:      p.Item,
+			TableName: p.TableName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreRow puts row with its NetId claim, NetId claimed by another workspace is not taken.
+// Overwritten row must not change since it is read, its claim of other NetId is released
+func (dd *DDBConn) restoreRow(r *dbCommon.WsRow, overwrite bool) error {
+	var cur *dbCommon.WsRow
+	if overwrite {
+		var err error
+		cur, err = dd.Get(r.Name)
+		if err == dbCommon.ErrWsNotFound {
+			cur = nil
+		} else if err != nil {
+			return err
+		}
+	}
+	put := &types.Put{
+		Item:                     wsItem(r),
+		ConditionExpression:      aws.String("attribute_not_exists(#N)"),
+		ExpressionAttributeNames: map[string]string{"#N": "name"},
+		TableName:                aws.String(dd.TableName),
+	}
+	if cur != nil {
+		put.ConditionExpression = aws.String("#V = :v")
+		put.ExpressionAttributeNames = map[string]string{"#V": "version"}
+		put.ExpressionAttributeValues = map[string]types.AttributeValue{":v": attrN(cur.Version)}
+	}
+	claim := &types.Put{
+		Item:                     netIdItem(r),
+		ConditionExpression:      aws.String("attribute_not_exists(net_id) OR #N = :n"),
+		ExpressionAttributeNames: map[string]string{"#N": "name"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":n": &types.AttributeValueMemberS{Value: r.Name},
 		},
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(1),
-			WriteCapacityUnits: aws.Int64(1),
-		},
-		TableName: aws.String(dd.TableName),
+		TableName: aws.String(dd.NetIdTableName),
+	}
+	items := []types.TransactWriteItem{{Put: put}, {Put: claim}}
+	if cur != nil && cur.NetId != r.NetId {
+		items = append(items, types.TransactWriteItem{Delete: dd.releaseNetId(*cur)})
+	}
+	err := dd.write(items, nil)
+	failed := conditionFailed(err)
+	if len(failed) < 1 {
+		return err
+	}
+	if failed[0] && cur != nil {
+		return dbCommon.ErrVersion
+	}
+	if failed[0] {
+		return dbCommon.ErrWsExists
+	}
+	if failed[1] {
+		return fmt.Errorf("%w: %d", dbCommon.ErrNetIdUsed, r.NetId)
 	}
-	_, err = dd.client.CreateTable(input)
 	return err
 }
 
-func (dd *DDBConn) Select(w map[string]interface{}) (*[]WsRow, error) {
-	var result []WsRow
-	if len(w) < 1 {
-		// Full Table Scan
-		input := &dynamodb.ScanInput{
-			AttributesToGet:           nil,
-			ConditionalOperator:       nil,
-			ConsistentRead:            nil,
-			ExclusiveStartKey:         nil,
-			ExpressionAttributeNames:  nil,
-			ExpressionAttributeValues: nil,
-			FilterExpression:          nil,
-			IndexName:                 nil,
-			Limit:                     nil,
-			ProjectionExpression:      nil,
-			ReturnConsumedCapacity:    nil,
-			ScanFilter:                nil,
-			Segment:                   nil,
-			Select:                    nil,
-			TableName:                 &dd.TableName,
-			TotalSegments:             nil,
-		}
-		res, err := dd.client.Scan(input)
+// usedNetIds returns NetIds of workspaces and claimed NetIds
+func (dd *DDBConn) usedNetIds() ([]uint32, error) {
+	var used []uint32
+	for _, tableName := range []string{dd.TableName, dd.NetIdTableName} {
+		items, err := dd.scan(&dynamodb.ScanInput{
+			ProjectionExpression: aws.String("net_id"),
+			ConsistentRead:       aws.Bool(true),
+			TableName:            aws.String(tableName),
+		})
 		if err != nil {
 			return nil, err
 		}
-		for _, r := range res.Items {
-			wsRow := WsRow{}
-			err = dynamodbattribute.UnmarshalMap(r, &wsRow)
-			if err != nil {
-				continue
+		for _, item := range items {
+			if netId, ok := attrUint(item["net_id"]); ok {
+				used = append(used, uint32(netId))
 			}
-			result = append(result, wsRow)
 		}
-		return &result, nil
-	} else {
+	}
+	return used, nil
+}
 
+func netIdItem(r *dbCommon.WsRow) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"net_id": attrN(uint64(r.NetId)),
+		"name":   &types.AttributeValueMemberS{Value: r.Name},
 	}
+}
 
-	return &result, nil
+// releaseNetId deletes NetId claim of workspace, rows created before claims have no one
+func (dd *DDBConn) releaseNetId(r dbCommon.WsRow) *types.Delete {
+	return &types.Delete{
+		Key: map[string]types.AttributeValue{
+			"net_id": attrN(uint64(r.NetId)),
+		},
+		ConditionExpression: aws.String("attribute_not_exists(net_id) OR #N = :n"),
+		ExpressionAttributeNames: map[string]string{
+			"#N": "name",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":n": &types.AttributeValueMemberS{Value: r.Name},
+		},
+		TableName: aws.String(dd.NetIdTableName),
+	}
 }
 
-func (dd *DDBConn) Insert(r WsRow) error {
-	av, err := dynamodbattribute.MarshalMap(r)
-	if err != nil {
-		return err
+// write applies items with history record in one transaction
+func (dd *DDBConn) write(items []types.TransactWriteItem, h *dbCommon.HistoryRow) error {
+	if h != nil {
+		items = append(items, types.TransactWriteItem{Put: dd.historyPut(h)})
 	}
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(dd.TableName),
+	_, err := dd.client.TransactWriteItems(dd.CTX, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	return err
+}
+
+func (dd *DDBConn) historyPut(h *dbCommon.HistoryRow) *types.Put {
+	item := map[string]types.AttributeValue{
+		"name":      &types.AttributeValueMemberS{Value: h.Name},
+		"ts":        attrN(uint64(h.Date.UnixNano() / 1000)),
+		"new_state": &types.AttributeValueMemberS{Value: h.NewState},
 	}
-	_, err = dd.client.PutItem(input)
-	if err != nil {
-		return err
+	// Empty string attributes are not allowed in old tables
+	for k, v := range map[string]string{"old_state": h.OldState, "actor": h.Actor, "reason": h.Reason} {
+		if len(v) > 0 {
+			item[k] = &types.AttributeValueMemberS{Value: v}
+		}
+	}
+	return &types.Put{
+		Item:      item,
+		TableName: aws.String(dd.HistoryTableName),
 	}
-	return nil
 }
 
-func (dd *DDBConn) Set(name string, state string) error {
-	input := &dynamodb.UpdateItemInput{
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":r": {
-				S: aws.String(state),
-			},
-			":u": {
-				S: aws.String(time.Now().String()),
+// SelectHistory returns history of workspace, history of all workspaces is returned for empty name
+func (dd *DDBConn) SelectHistory(name string) (*[]dbCommon.HistoryRow, error) {
+	var items []map[string]types.AttributeValue
+	var err error
+	if len(name) < 1 {
+		items, err = dd.scan(&dynamodb.ScanInput{
+			TableName: aws.String(dd.HistoryTableName),
+		})
+	} else {
+		items, err = dd.query(&dynamodb.QueryInput{
+			KeyConditionExpression: aws.String("#N = :n"),
+			ExpressionAttributeNames: map[string]string{
+				"#N": "name",
 			},
-		},
-		ExpressionAttributeNames: map[string]*string{
-			"#S": aws.String("state"),
-		},
-		TableName: aws.String(dd.TableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"name": {
-				S: aws.String(name),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":n": &types.AttributeValueMemberS{Value: name},
 			},
-		},
-		ReturnValues:     aws.String("UPDATED_NEW"),
-		UpdateExpression: aws.String("set #S = :r, update_date = :u"),
+			TableName: aws.String(dd.HistoryTableName),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []dbCommon.HistoryRow
+	for _, item := range items {
+		result = append(result, historyFromItem(item))
+	}
+	return &result, nil
+}
+
+func historyFromItem(item map[string]types.AttributeValue) dbCommon.HistoryRow {
+	h := dbCommon.HistoryRow{
+		Name:     attrString(item["name"]),
+		OldState: attrString(item["old_state"]),
+		NewState: attrString(item["new_state"]),
+		Actor:    attrString(item["actor"]),
+		Reason:   attrString(item["reason"]),
+	}
+	if us, ok := attrUint(item["ts"]); ok {
+		h.Date = dbCommon.CanonicalTime(time.Unix(0, int64(us)*1000))
+	}
+	return h
+}
+
+// Set updates row fields only if row version still equal to version, row version is incremented.
+// Nil field value removes attribute. History record is written in the same transaction if not nil
+func (dd *DDBConn) Set(name string, version uint64, sf map[string]interface{}, h *dbCommon.HistoryRow) error {
+	condition, names, values := versionCondition(version)
+	values[":u"] = timeAttr(dbCommon.Now())
+	values[":nv"] = attrN(version + 1)
+	setExpr := "set update_date = :u, #V = :nv"
+	removeExpr := ""
+	n := 0
+	for k, v := range sf {
+		n++
+		kName := fmt.Sprintf("#f%d", n)
+		names[kName] = k
+		if v == nil {
+			if len(removeExpr) > 0 {
+				removeExpr += ", "
+			}
+			removeExpr += kName
+			continue
+		}
+		av, err := marshalValue(v)
+		if err != nil {
+			return err
+		}
+		vName := fmt.Sprintf(":f%d", n)
+		values[vName] = av
+		setExpr += fmt.Sprintf(", %s = %s", kName, vName)
+	}
+	if len(removeExpr) > 0 {
+		setExpr += " remove " + removeExpr
+	}
+	update := &types.Update{
+		ExpressionAttributeValues: values,
+		ExpressionAttributeNames:  names,
+		TableName:                 aws.String(dd.TableName),
+		Key:                       wsKey(name),
+		ConditionExpression:       aws.String(condition),
+		UpdateExpression:          aws.String(setExpr),
+	}
+	err := dd.write([]types.TransactWriteItem{{Update: update}}, h)
+	if isConditionFailed(err) {
+		return dbCommon.ErrVersion
+	}
+	return err
+}
+
+// Delete removes row and its NetId claim if row version still equal to version
+func (dd *DDBConn) Delete(r dbCommon.WsRow, h *dbCommon.HistoryRow) error {
+	err := dd.write([]types.TransactWriteItem{{Delete: dd.deleteCAS(r.Name, r.Version)}, {Delete: dd.releaseNetId(r)}}, h)
+	if isConditionFailed(err) {
+		return dbCommon.ErrVersion
+	}
+	return err
+}
+
+// Archive moves row to archive table if row version still equal to version
+func (dd *DDBConn) Archive(r dbCommon.WsRow, h *dbCommon.HistoryRow) error {
+	av := wsItem(&r)
+	av["archive_ts"] = attrN(uint64(dbCommon.Now().UnixNano() / 1000))
+	put := &types.Put{
+		Item:      av,
+		TableName: aws.String(dd.ArchiveTableName),
+	}
+	err := dd.write([]types.TransactWriteItem{{Put: put}, {Delete: dd.deleteCAS(r.Name, r.Version)}, {Delete: dd.releaseNetId(r)}}, h)
+	if isConditionFailed(err) {
+		return dbCommon.ErrVersion
 	}
-	_, err := dd.client.UpdateItem(input)
 	return err
 }
+
+func (dd *DDBConn) deleteCAS(name string, version uint64) *types.Delete {
+	condition, names, values := versionCondition(version)
+	return &types.Delete{
+		ExpressionAttributeValues: values,
+		ExpressionAttributeNames:  names,
+		TableName:                 aws.String(dd.TableName),
+		Key:                       wsKey(name),
+		ConditionExpression:       aws.String(condition),
+	}
+}
+
+func wsKey(name string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"name": &types.AttributeValueMemberS{Value: name},
+	}
+}
+
+// versionCondition returns condition expression checking row version with its names and values
+func versionCondition(version uint64) (string, map[string]string, map[string]types.AttributeValue) {
+	names := map[string]string{
+		"#N": "name",
+		"#V": "version",
+	}
+	values := map[string]types.AttributeValue{
+		":v": attrN(version),
+	}
+	// Rows created before versioning have no version attribute
+	condition := "attribute_exists(#N) AND #V = :v"
+	if version == 0 {
+		condition = "attribute_exists(#N) AND (attribute_not_exists(#V) OR #V = :v)"
+	}
+	return condition, names, values
+}
+
+// isConditionFailed reports condition check failure of single item or transaction write
+func isConditionFailed(err error) bool {
+	var ccErr *types.ConditionalCheckFailedException
+	if errors.As(err, &ccErr) {
+		return true
+	}
+	return len(conditionFailed(err)) > 0
+}
+
+// conditionFailed returns per transaction item condition check failures, nil if no one failed
+func conditionFailed(err error) []bool {
+	var txErr *types.TransactionCanceledException
+	if !errors.As(err, &txErr) {
+		return nil
+	}
+	var failed []bool
+	found := false
+	for _, r := range txErr.CancellationReasons {
+		f := aws.ToString(r.Code) == "ConditionalCheckFailed"
+		found = found || f
+		failed = append(failed, f)
+	}
+	if !found {
+		return nil
+	}
+	return failed
+}
@@ -0,0 +1,66 @@
+package dynamoDB
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strings"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+)
+
+// Find returns rows passing filter, state is looked up by secondary index.
+// Date ranges compare canonical strings, rows of older releases need --db-repair-dates
+func (dd *DDBConn) Find(f dbCommon.Filter) (*[]dbCommon.WsRow, error) {
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	var conds []string
+	if len(f.NamePrefix) > 0 {
+		names["#N"] = "name"
+		values[":np"] = &types.AttributeValueMemberS{Value: f.NamePrefix}
+		conds = append(conds, "begins_with(#N, :np)")
+	}
+	if f.HaMode != nil {
+		names["#H"] = "ha_mode"
+		values[":ha"] = &types.AttributeValueMemberBOOL{Value: *f.HaMode}
+		conds = append(conds, "#H = :ha")
+	}
+	for i, r := range f.Ranges() {
+		names[fmt.Sprintf("#d%d", i)] = r.Column
+		values[fmt.Sprintf(":d%d", i)] = timeAttr(*r.Value)
+		conds = append(conds, fmt.Sprintf("#d%d %s :d%d", i, r.Op, i))
+	}
+	var filter *string
+	if len(conds) > 0 {
+		filter = aws.String(strings.Join(conds, " AND "))
+	}
+	var items []map[string]types.AttributeValue
+	var err error
+	if len(f.State) > 0 {
+		names["#S"] = "state"
+		values[":s"] = &types.AttributeValueMemberS{Value: f.State}
+		items, err = dd.query(&dynamodb.QueryInput{
+			TableName:                 aws.String(dd.TableName),
+			IndexName:                 aws.String(stateIndexName),
+			KeyConditionExpression:    aws.String("#S = :s"),
+			FilterExpression:          filter,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+	} else {
+		input := &dynamodb.ScanInput{
+			TableName:        aws.String(dd.TableName),
+			FilterExpression: filter,
+		}
+		// Empty expression maps are rejected by DynamoDB
+		if len(conds) > 0 {
+			input.ExpressionAttributeNames = names
+			input.ExpressionAttributeValues = values
+		}
+		items, err = dd.scan(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return wsFromItems(items)
+}
@@ -0,0 +1,202 @@
+package dynamoDB
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strconv"
+	"strings"
+	"time"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+)
+
+// wsTimeAttrs are row timestamps stored as canonical strings
+var wsTimeAttrs = []string{"create_date", "update_date", "lock_expire"}
+
+// wsItem encodes row with canonical timestamps, empty lock attributes are omitted
+func wsItem(r *dbCommon.WsRow) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"name":        &types.AttributeValueMemberS{Value: r.Name},
+		"net_id":      attrN(uint64(r.NetId)),
+		"create_date": timeAttr(r.CreateDate),
+		"update_date": timeAttr(r.UpdateDate),
+		"state":       &types.AttributeValueMemberS{Value: r.State},
+		"ha_mode":     &types.AttributeValueMemberBOOL{Value: r.HaMode},
+		"version":     attrN(r.Version),
+	}
+	if len(r.LockOwner) > 0 {
+		item["lock_owner"] = &types.AttributeValueMemberS{Value: r.LockOwner}
+	}
+	if r.LockExpire != nil {
+		item["lock_expire"] = timeAttr(*r.LockExpire)
+	}
+	return item
+}
+
+// wsFromItem decodes row, timestamps written by older releases are accepted
+func wsFromItem(item map[string]types.AttributeValue) (*dbCommon.WsRow, error) {
+	r := &dbCommon.WsRow{
+		Name:      attrString(item["name"]),
+		State:     attrString(item["state"]),
+		LockOwner: attrString(item["lock_owner"]),
+	}
+	if netId, ok := attrUint(item["net_id"]); ok {
+		r.NetId = uint32(netId)
+	}
+	if version, ok := attrUint(item["version"]); ok {
+		r.Version = version
+	}
+	if av, ok := item["ha_mode"].(*types.AttributeValueMemberBOOL); ok {
+		r.HaMode = av.Value
+	}
+	for _, k := range wsTimeAttrs {
+		av, ok := item[k].(*types.AttributeValueMemberS)
+		if !ok {
+			continue
+		}
+		t, err := dbCommon.ParseTime(av.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", r.Name, k, err)
+		}
+		switch k {
+		case "create_date":
+			r.CreateDate = t
+		case "update_date":
+			r.UpdateDate = t
+		case "lock_expire":
+			r.LockExpire = &t
+		}
+	}
+	return r, nil
+}
+
+func wsFromItems(items []map[string]types.AttributeValue) (*[]dbCommon.WsRow, error) {
+	var result []dbCommon.WsRow
+	for _, item := range items {
+		r, err := wsFromItem(item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *r)
+	}
+	return &result, nil
+}
+
+// marshalValue encodes field value of update or filter
+func marshalValue(v interface{}) (types.AttributeValue, error) {
+	switch t := v.(type) {
+	case string:
+		return &types.AttributeValueMemberS{Value: t}, nil
+	case bool:
+		return &types.AttributeValueMemberBOOL{Value: t}, nil
+	case uint32:
+		return attrN(uint64(t)), nil
+	case uint64:
+		return attrN(t), nil
+	case time.Time:
+		return timeAttr(t), nil
+	default:
+		return nil, fmt.Errorf("Unsupported attribute value type: %T", v)
+	}
+}
+
+func timeAttr(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: dbCommon.FormatTime(t)}
+}
+
+func attrN(n uint64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatUint(n, 10)}
+}
+
+// attrString returns value of string attribute, empty string for missing or NULL one
+func attrString(av types.AttributeValue) string {
+	if s, ok := av.(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
+
+func attrUint(av types.AttributeValue) (uint64, bool) {
+	n, ok := av.(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(n.Value, 10, 64)
+	return v, err == nil
+}
+
+// RepairDates rewrites timestamps written by older releases in canonical form,
+// returns number of repaired rows of workspace and archive tables
+func (dd *DDBConn) RepairDates() (int, error) {
+	n, err := dd.repairTable(dd.TableName, []string{"name"})
+	if err != nil {
+		return n, err
+	}
+	_, err = dd.describeTable(dd.ArchiveTableName)
+	if err == errTableNotFound {
+		return n, nil
+	}
+	if err != nil {
+		return n, err
+	}
+	m, err := dd.repairTable(dd.ArchiveTableName, []string{"name", "archive_ts"})
+	return n + m, err
+}
+
+// repairTable updates timestamps only if they are not changed since scan
+func (dd *DDBConn) repairTable(tableName string, keys []string) (int, error) {
+	items, err := dd.scan(&dynamodb.ScanInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, item := range items {
+		names := map[string]string{}
+		values := map[string]types.AttributeValue{}
+		var sets, conds []string
+		for i, k := range wsTimeAttrs {
+			av, ok := item[k].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			t, err := dbCommon.ParseTime(av.Value)
+			if err != nil {
+				return n, fmt.Errorf("%s %s: %w", tableName, attrString(item["name"]), err)
+			}
+			c := dbCommon.FormatTime(t)
+			if c == av.Value {
+				continue
+			}
+			names[fmt.Sprintf("#t%d", i)] = k
+			values[fmt.Sprintf(":t%d", i)] = &types.AttributeValueMemberS{Value: c}
+			values[fmt.Sprintf(":o%d", i)] = av
+			sets = append(sets, fmt.Sprintf("#t%d = :t%d", i, i))
+			conds = append(conds, fmt.Sprintf("#t%d = :o%d", i, i))
+		}
+		if len(sets) < 1 {
+			continue
+		}
+		key := map[string]types.AttributeValue{}
+		for _, k := range keys {
+			key[k] = item[k]
+		}
+		_, err := dd.client.UpdateItem(dd.CTX, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(tableName),
+			Key:                       key,
+			UpdateExpression:          aws.String("SET " + strings.Join(sets, ", ")),
+			ConditionExpression:       aws.String(strings.Join(conds, " AND ")),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+		// Row is updated by somebody else since scan
+		if isConditionFailed(err) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
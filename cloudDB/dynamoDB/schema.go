@@ -0,0 +1,209 @@
+package dynamoDB
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"time"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+)
+
+const (
+	stateIndexName = "state_idx"
+	// schemaKey is the name of meta table item with schema version
+	schemaKey = "schema"
+	// Index is built asynchronously, its status is polled until it is active
+	indexWaitTimeout  = 30 * time.Minute
+	indexPollInterval = 10 * time.Second
+)
+
+var (
+	errTableNotFound = errors.New("Table not found")
+	errIndexTimeout  = errors.New("Index is not active in time, run --db-migrate again later")
+)
+
+// stateIndex is global secondary index of workspace table on state
+func (dd *DDBConn) stateIndex() types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(stateIndexName),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("state"), KeyType: types.KeyTypeHash},
+		},
+		Projection:            &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		ProvisionedThroughput: dd.Billing.throughput(),
+	}
+}
+
+// migrations upgrade tables created by older releases, every step must tolerate partially applied changes
+func (dd *DDBConn) migrations() []dbCommon.Migration {
+	return []dbCommon.Migration{
+		{Version: 2, Name: "add version to rows, history and net_id tables", Apply: dd.migrateLocks},
+		{Version: 3, Name: "add index on state", Apply: dd.migrateStateIndex},
+	}
+}
+
+func (dd *DDBConn) migrateLocks() error {
+	err := dd.createAuxTables()
+	if err != nil {
+		return err
+	}
+	items, err := dd.scan(&dynamodb.ScanInput{
+		TableName:                aws.String(dd.TableName),
+		FilterExpression:         aws.String("attribute_not_exists(version)"),
+		ProjectionExpression:     aws.String("#N"),
+		ExpressionAttributeNames: map[string]string{"#N": "name"},
+	})
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		_, err = dd.client.UpdateItem(dd.CTX, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(dd.TableName),
+			Key:                 wsKey(attrString(item["name"])),
+			UpdateExpression:    aws.String("SET version = :v"),
+			ConditionExpression: aws.String("attribute_exists(#N) AND attribute_not_exists(version)"),
+			ExpressionAttributeNames: map[string]string{
+				"#N": "name",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":v": attrN(1),
+			},
+		})
+		if err != nil && !isConditionFailed(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dd *DDBConn) migrateStateIndex() error {
+	desc, err := dd.describeTable(dd.TableName)
+	if err != nil {
+		return err
+	}
+	for _, idx := range desc.GlobalSecondaryIndexes {
+		if aws.ToString(idx.IndexName) == stateIndexName {
+			return dd.waitIndexActive(stateIndexName)
+		}
+	}
+	gsi := dd.stateIndex()
+	create := &types.CreateGlobalSecondaryIndexAction{
+		IndexName:  gsi.IndexName,
+		KeySchema:  gsi.KeySchema,
+		Projection: gsi.Projection,
+	}
+	// Index throughput follows billing mode of existing table
+	if desc.BillingModeSummary == nil || desc.BillingModeSummary.BillingMode != types.BillingModePayPerRequest {
+		create.ProvisionedThroughput = dd.Billing.provisioned()
+	}
+	_, err = dd.client.UpdateTable(dd.CTX, &dynamodb.UpdateTableInput{
+		TableName: aws.String(dd.TableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("state"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{Create: create}},
+	})
+	if err != nil {
+		return err
+	}
+	// Find queries index, so schema version is stored only after index is built
+	return dd.waitIndexActive(stateIndexName)
+}
+
+// waitIndexActive polls table until global secondary index is active
+func (dd *DDBConn) waitIndexActive(name string) error {
+	deadline := time.Now().Add(indexWaitTimeout)
+	for {
+		desc, err := dd.describeTable(dd.TableName)
+		if err != nil {
+			return err
+		}
+		status := types.IndexStatus("")
+		for _, idx := range desc.GlobalSecondaryIndexes {
+			if aws.ToString(idx.IndexName) == name {
+				status = idx.IndexStatus
+			}
+		}
+		if status == types.IndexStatusActive {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s is %s", errIndexTimeout, name, status)
+		}
+		time.Sleep(indexPollInterval)
+	}
+}
+
+// Migrate upgrades registry schema to current version, missing registry is created
+func (dd *DDBConn) Migrate() ([]dbCommon.Migration, error) {
+	version, err := dd.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, dd.CreateTable()
+	}
+	err = dd.createTable(dd.MetaTableName, map[string]string{"name": "S"}, []string{"name"})
+	if err != nil {
+		return nil, err
+	}
+	return dbCommon.Migrate(version, dd.migrations(), dd.SetSchemaVersion)
+}
+
+// SchemaVersion returns registry schema version, 0 if registry does not exist.
+// Tables without meta table are created by first releases
+func (dd *DDBConn) SchemaVersion() (uint32, error) {
+	_, err := dd.describeTable(dd.TableName)
+	if err == errTableNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	out, err := dd.client.GetItem(dd.CTX, &dynamodb.GetItemInput{
+		TableName:      aws.String(dd.MetaTableName),
+		Key:            map[string]types.AttributeValue{"name": &types.AttributeValueMemberS{Value: schemaKey}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if isNotFound(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, ok := attrUint(out.Item["version"])
+	if !ok {
+		return 1, nil
+	}
+	return uint32(version), nil
+}
+
+func (dd *DDBConn) SetSchemaVersion(version uint32) error {
+	_, err := dd.client.PutItem(dd.CTX, &dynamodb.PutItemInput{
+		TableName: aws.String(dd.MetaTableName),
+		Item: map[string]types.AttributeValue{
+			"name":    &types.AttributeValueMemberS{Value: schemaKey},
+			"version": attrN(uint64(version)),
+		},
+	})
+	return err
+}
+
+// describeTable returns errTableNotFound if table does not exist
+func (dd *DDBConn) describeTable(name string) (*types.TableDescription, error) {
+	out, err := dd.client.DescribeTable(dd.CTX, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+	if isNotFound(err) {
+		return nil, errTableNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Table, nil
+}
+
+func isNotFound(err error) bool {
+	var nfErr *types.ResourceNotFoundException
+	return errors.As(err, &nfErr)
+}
@@ -0,0 +1,169 @@
+package cloudDB
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+)
+
+// Import conflict strategies for workspaces existing in target backend
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+	ImportFail      = "fail"
+)
+
+// ExportRecord is one line of registry dump: workspace row with its history,
+// row is absent for deleted or archived workspaces having history only
+type ExportRecord struct {
+	Workspace *dbCommon.WsRow       `json:"workspace,omitempty"`
+	History   []dbCommon.HistoryRow `json:"history,omitempty"`
+}
+
+// Export writes all workspaces with history as JSON lines sorted by workspace name
+func Export(db CloudDB, w io.Writer) error {
+	rows, history, err := db.Dump()
+	if err != nil {
+		return err
+	}
+	records := map[string]*ExportRecord{}
+	for i := range rows {
+		records[rows[i].Name] = &ExportRecord{Workspace: &rows[i]}
+	}
+	for _, h := range history {
+		rec, ok := records[h.Name]
+		if !ok {
+			rec = &ExportRecord{}
+			records[h.Name] = rec
+		}
+		rec.History = append(rec.History, h)
+	}
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	enc := json.NewEncoder(w)
+	for _, name := range names {
+		rec := records[name]
+		sort.SliceStable(rec.History, func(i, j int) bool {
+			return rec.History[i].Date.Before(rec.History[j].Date)
+		})
+		err = enc.Encode(rec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importLine is record of dump with its line number
+type importLine struct {
+	line int
+	rec  ExportRecord
+}
+
+// Import restores JSON lines written by Export keeping dates and versions as is.
+// Whole dump is validated against itself and target registry before anything is written
+func Import(db CloudDB, r io.Reader, mode string) error {
+	switch mode {
+	case ImportSkip, ImportOverwrite, ImportFail:
+	default:
+		return fmt.Errorf("Unknown import mode: %s", mode)
+	}
+	lines, err := readDump(r)
+	if err != nil {
+		return err
+	}
+	existing, err := db.Find(dbCommon.Filter{})
+	if err != nil {
+		return err
+	}
+	err = checkImport(lines, existing, mode)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		err = db.Restore(l.rec.Workspace, l.rec.History, mode == ImportOverwrite)
+		if err == dbCommon.ErrWsExists && mode == ImportSkip {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Line %d: %w", l.line, err)
+		}
+	}
+	return nil
+}
+
+// readDump reads all records of dump in canonical form
+func readDump(r io.Reader) ([]importLine, error) {
+	var lines []importLine
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) < 1 {
+			continue
+		}
+		rec := ExportRecord{}
+		err := json.Unmarshal(sc.Bytes(), &rec)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %w", line, err)
+		}
+		if rec.Workspace != nil && len(rec.Workspace.Name) < 1 {
+			return nil, fmt.Errorf("Line %d: workspace name is empty", line)
+		}
+		// Dumps of older releases may have local time zones and nanoseconds
+		if rec.Workspace != nil {
+			dbCommon.CanonicalRow(rec.Workspace)
+		}
+		for i := range rec.History {
+			rec.History[i].Date = dbCommon.CanonicalTime(rec.History[i].Date)
+		}
+		lines = append(lines, importLine{line: line, rec: rec})
+	}
+	return lines, sc.Err()
+}
+
+// checkImport refuses duplicate names and NetIds of dump, workspaces existing in fail mode
+// and NetIds used by other workspaces of target registry
+func checkImport(lines []importLine, existing []dbCommon.WsRow, mode string) error {
+	names := map[string]int{}
+	netIds := map[uint32]string{}
+	exists := map[string]bool{}
+	for _, r := range existing {
+		netIds[r.NetId] = r.Name
+		exists[r.Name] = true
+	}
+	dumpNetIds := map[uint32]int{}
+	for _, l := range lines {
+		ws := l.rec.Workspace
+		if ws == nil {
+			continue
+		}
+		if prev, ok := names[ws.Name]; ok {
+			return fmt.Errorf("Line %d: workspace %s is duplicate of line %d", l.line, ws.Name, prev)
+		}
+		names[ws.Name] = l.line
+		if prev, ok := dumpNetIds[ws.NetId]; ok {
+			return fmt.Errorf("Line %d: %w: %d is used at line %d", l.line, dbCommon.ErrNetIdUsed, ws.NetId, prev)
+		}
+		dumpNetIds[ws.NetId] = l.line
+		if exists[ws.Name] {
+			if mode == ImportFail {
+				return fmt.Errorf("Line %d: %w: %s", l.line, dbCommon.ErrWsExists, ws.Name)
+			}
+			if mode == ImportSkip {
+				continue
+			}
+		}
+		if owner, ok := netIds[ws.NetId]; ok && owner != ws.Name {
+			return fmt.Errorf("Line %d: %w: %d by %s", l.line, dbCommon.ErrNetIdUsed, ws.NetId, owner)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package local
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+	"ya-ansible-inventory/common"
+)
+
+var (
+	errSetState = errors.New("Set state. Must set ws Name and ws State")
+)
+
+func MakeCloudDBLocal() (*CdbLocal, error) {
+	envLabels := []string{"LOCAL_DB"}
+	envs, err := common.CheckEnvs(envLabels)
+	if err != nil {
+		return nil, fmt.Errorf("You must set this ENVs: %s", strings.Join(envLabels, ", "))
+	}
+	netIds, err := dbCommon.NetIdRangeFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &CdbLocal{fs: &FileStore{Path: envs["LOCAL_DB"]}, netIds: netIds}, nil
+}
+
+// CdbLocal keeps workspaces in local JSON file
+type CdbLocal struct {
+	fs     *FileStore
+	netIds dbCommon.NetIdRange
+}
+
+func (l *CdbLocal) Close() {
+}
+
+func (l *CdbLocal) List(f dbCommon.Filter, format string) error {
+	result, err := l.Find(f)
+	if err != nil {
+		return err
+	}
+	return dbCommon.WriteRows(os.Stdout, result, format)
+}
+
+func (l *CdbLocal) Find(f dbCommon.Filter) ([]dbCommon.WsRow, error) {
+	var result []dbCommon.WsRow
+	err := l.fs.View(func(st *store) error {
+		for _, r := range st.Workspaces {
+			if f.Match(r) {
+				result = append(result, r)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (l *CdbLocal) History(name string) error {
+	var result []dbCommon.HistoryRow
+	err := l.fs.View(func(st *store) error {
+		for _, h := range st.History {
+			if h.Name == name {
+				result = append(result, h)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s, err := common.StringDumpErr(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
+
+func (l *CdbLocal) Create(j string, o dbCommon.Opts) error {
+	inRow := dbCommon.WsRow{}
+	err := json.Unmarshal([]byte(j), &inRow)
+	if err != nil {
+		return err
+	}
+	netIdGiven, err := dbCommon.NetIdGiven(j)
+	if err != nil {
+		return err
+	}
+	inRow.State = dbCommon.StateCreating
+	inRow.CreateDate = dbCommon.Now()
+	inRow.UpdateDate = dbCommon.Now()
+	inRow.Version = 1
+	inRow.LockOwner = ""
+	inRow.LockExpire = nil
+	err = l.fs.Update(func(st *store) error {
+		if _, ok := st.Workspaces[inRow.Name]; ok {
+			return dbCommon.ErrWsExists
+		}
+		var used []uint32
+		for _, r := range st.Workspaces {
+			used = append(used, r.NetId)
+		}
+		var err error
+		if netIdGiven {
+			err = dbCommon.CheckNetId(inRow.NetId, used)
+		} else {
+			inRow.NetId, err = dbCommon.LowestFreeNetId(used, l.netIds)
+		}
+		if err != nil {
+			return err
+		}
+		st.Workspaces[inRow.Name] = inRow
+		st.History = append(st.History, *dbCommon.NewHistoryRow(inRow.Name, "", inRow.State, o))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s, err := common.StringDumpErr(inRow)
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
+
+func (l *CdbLocal) SetState(j string, o dbCommon.Opts) error {
+	inRow := dbCommon.WsRow{}
+	err := json.Unmarshal([]byte(j), &inRow)
+	if err != nil {
+		return err
+	}
+	if len(inRow.Name) < 1 || len(inRow.State) < 1 {
+		return errSetState
+	}
+	return l.fs.Update(func(st *store) error {
+		cur, ok := st.Workspaces[inRow.Name]
+		if !ok {
+			return dbCommon.ErrWsNotFound
+		}
+		err := dbCommon.CheckVersion(inRow.Version, cur.Version)
+		if err != nil {
+			return err
+		}
+		err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+		if err != nil {
+			return err
+		}
+		err = dbCommon.CheckTransition(cur.State, inRow.State, o.Force)
+		if err != nil {
+			return err
+		}
+		st.History = append(st.History, *dbCommon.NewHistoryRow(cur.Name, cur.State, inRow.State, o))
+		cur.State = inRow.State
+		cur.Version++
+		cur.UpdateDate = dbCommon.Now()
+		st.Workspaces[cur.Name] = cur
+		return nil
+	})
+}
+
+func (l *CdbLocal) Lock(name string, ttl time.Duration, o dbCommon.Opts) error {
+	if len(o.Owner) < 1 {
+		return dbCommon.ErrOwner
+	}
+	return l.fs.Update(func(st *store) error {
+		cur, ok := st.Workspaces[name]
+		if !ok {
+			return dbCommon.ErrWsNotFound
+		}
+		err := dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+		if err != nil {
+			return err
+		}
+		lockExpire := dbCommon.Now().Add(ttl)
+		cur.LockOwner = o.Owner
+		cur.LockExpire = &lockExpire
+		cur.Version++
+		cur.UpdateDate = dbCommon.Now()
+		st.Workspaces[name] = cur
+		return nil
+	})
+}
+
+func (l *CdbLocal) Unlock(name string, o dbCommon.Opts) error {
+	return l.fs.Update(func(st *store) error {
+		cur, ok := st.Workspaces[name]
+		if !ok {
+			return dbCommon.ErrWsNotFound
+		}
+		if len(cur.LockOwner) < 1 {
+			return nil
+		}
+		err := dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+		if err != nil {
+			return err
+		}
+		cur.LockOwner = ""
+		cur.LockExpire = nil
+		cur.Version++
+		cur.UpdateDate = dbCommon.Now()
+		st.Workspaces[name] = cur
+		return nil
+	})
+}
+
+func (l *CdbLocal) Delete(name string, o dbCommon.Opts) error {
+	return l.fs.Update(func(st *store) error {
+		cur, err := removable(st, name, o)
+		if err != nil {
+			return err
+		}
+		delete(st.Workspaces, name)
+		st.History = append(st.History, *dbCommon.NewHistoryRow(name, cur.State, dbCommon.StateDeleted, o))
+		return nil
+	})
+}
+
+func (l *CdbLocal) Archive(name string, o dbCommon.Opts) error {
+	return l.fs.Update(func(st *store) error {
+		cur, err := removable(st, name, o)
+		if err != nil {
+			return err
+		}
+		delete(st.Workspaces, name)
+		st.Archive = append(st.Archive, ArchiveRow{WsRow: cur, ArchiveDate: dbCommon.Now()})
+		st.History = append(st.History, *dbCommon.NewHistoryRow(name, cur.State, dbCommon.StateArchived, o))
+		return nil
+	})
+}
+
+// removable returns workspace if it may be deleted or archived
+func removable(st *store, name string, o dbCommon.Opts) (dbCommon.WsRow, error) {
+	cur, ok := st.Workspaces[name]
+	if !ok {
+		return cur, dbCommon.ErrWsNotFound
+	}
+	err := dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return cur, err
+	}
+	return cur, dbCommon.CheckRemove(cur.State, o.Force)
+}
+
+func (l *CdbLocal) Dump() ([]dbCommon.WsRow, []dbCommon.HistoryRow, error) {
+	var rows []dbCommon.WsRow
+	var history []dbCommon.HistoryRow
+	err := l.fs.View(func(st *store) error {
+		for _, r := range st.Workspaces {
+			rows = append(rows, r)
+		}
+		history = st.History
+		return nil
+	})
+	return rows, history, err
+}
+
+func (l *CdbLocal) Restore(r *dbCommon.WsRow, history []dbCommon.HistoryRow, overwrite bool) error {
+	return l.fs.Update(func(st *store) error {
+		if r != nil {
+			if _, ok := st.Workspaces[r.Name]; ok && !overwrite {
+				return dbCommon.ErrWsExists
+			}
+			st.Workspaces[r.Name] = *r
+		}
+		// History records are identified by workspace and date
+		known := map[string]bool{}
+		for _, h := range st.History {
+			known[h.Name+h.Date.String()] = true
+		}
+		for _, h := range history {
+			if !known[h.Name+h.Date.String()] {
+				st.History = append(st.History, h)
+			}
+		}
+		return nil
+	})
+}
+
+func (l *CdbLocal) SchemaVersion() (uint32, error) {
+	ok, err := l.fs.Exists()
+	if err != nil || !ok {
+		return 0, err
+	}
+	var version uint32
+	err = l.fs.View(func(st *store) error {
+		version = st.SchemaVersion
+		return nil
+	})
+	return version, err
+}
+
+// Migrate upgrades state file schema, all migrations are saved at once
+func (l *CdbLocal) Migrate() ([]dbCommon.Migration, error) {
+	var applied []dbCommon.Migration
+	err := l.fs.Update(func(st *store) error {
+		var err error
+		applied, err = dbCommon.Migrate(st.SchemaVersion, []dbCommon.Migration{
+			// JSON file is always scanned, there is no index to create
+			{Version: 3, Name: "add index on state", Apply: func() error { return nil }},
+		}, func(version uint32) error {
+			st.SchemaVersion = version
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		// State file is not saved on error, no migration is applied
+		return nil, err
+	}
+	return applied, nil
+}
+
+// RepairDates rewrites all timestamps of state file in canonical form,
+// returns number of repaired rows
+func (l *CdbLocal) RepairDates() (int, error) {
+	n := 0
+	err := l.fs.Update(func(st *store) error {
+		for name, r := range st.Workspaces {
+			if dbCommon.CanonicalRow(&r) {
+				st.Workspaces[name] = r
+				n++
+			}
+		}
+		for i := range st.History {
+			st.History[i].Date = dbCommon.CanonicalTime(st.History[i].Date)
+		}
+		for i := range st.Archive {
+			c := dbCommon.CanonicalTime(st.Archive[i].ArchiveDate)
+			if dbCommon.CanonicalRow(&st.Archive[i].WsRow) || !c.Equal(st.Archive[i].ArchiveDate) {
+				n++
+			}
+			st.Archive[i].ArchiveDate = c
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,472 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+)
+
+func testDB(t *testing.T) *CdbLocal {
+	t.Helper()
+	return &CdbLocal{
+		fs:     &FileStore{Path: filepath.Join(t.TempDir(), "state.json")},
+		netIds: dbCommon.NetIdRange{Min: 10, Max: 12},
+	}
+}
+
+func getRow(t *testing.T, l *CdbLocal, name string) dbCommon.WsRow {
+	t.Helper()
+	var r dbCommon.WsRow
+	var ok bool
+	err := l.fs.View(func(st *store) error {
+		r, ok = st.Workspaces[name]
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("workspace %s not found", name)
+	}
+	return r
+}
+
+func TestCreate(t *testing.T) {
+	l := testDB(t)
+	o := dbCommon.Opts{Owner: "ci"}
+	for _, name := range []string{"a", "b"} {
+		err := l.Create(fmt.Sprintf(`{"name":%q}`, name), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := l.Create(`{"name":"c","net_id":20}`, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]uint32{"a": 10, "b": 11, "c": 20} {
+		r := getRow(t, l, name)
+		if r.NetId != want {
+			t.Errorf("%s NetId = %d, want %d", name, r.NetId, want)
+		}
+		if r.State != dbCommon.StateCreating || r.Version != 1 {
+			t.Errorf("%s created as %s version %d", name, r.State, r.Version)
+		}
+	}
+	// Freed NetId is reused, the lowest first
+	err = l.Delete("a", dbCommon.Opts{Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Create(`{"name":"d"}`, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := getRow(t, l, "d"); r.NetId != 10 {
+		t.Errorf("d NetId = %d, want 10", r.NetId)
+	}
+
+	tests := []struct {
+		name string
+		json string
+		err  bool
+	}{
+		{"existing name", `{"name":"b"}`, true},
+		{"used NetId", `{"name":"e","net_id":11}`, true},
+		{"last free NetId", `{"name":"e"}`, false},
+		{"range exhausted", `{"name":"f"}`, true},
+	}
+	for _, tt := range tests {
+		err := l.Create(tt.json, o)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.err)
+		}
+	}
+	if r := getRow(t, l, "e"); r.NetId != 12 {
+		t.Errorf("e NetId = %d, want 12", r.NetId)
+	}
+}
+
+func TestCreateConcurrent(t *testing.T) {
+	l := testDB(t)
+	l.netIds = dbCommon.NetIdRange{Min: 1, Max: 255}
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every call has its own file descriptors, so flock serializes them as separate processes
+			other := &CdbLocal{fs: &FileStore{Path: l.fs.Path}, netIds: l.netIds}
+			errs <- other.Create(fmt.Sprintf(`{"name":"ws%d"}`, i), dbCommon.Opts{})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, history, err := l.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != n || len(history) != n {
+		t.Fatalf("%d workspaces and %d history rows, want %d", len(rows), len(history), n)
+	}
+	var ids []int
+	for _, r := range rows {
+		ids = append(ids, int(r.NetId))
+	}
+	sort.Ints(ids)
+	for i, id := range ids {
+		if id != i+1 {
+			t.Fatalf("NetIds are not unique and dense: %v", ids)
+		}
+	}
+}
+
+func TestSetState(t *testing.T) {
+	l := testDB(t)
+	o := dbCommon.Opts{Owner: "ci"}
+	err := l.Create(`{"name":"a"}`, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		json  string
+		force bool
+		err   bool
+		state string
+	}{
+		{`{"name":"a","state":"ready"}`, false, false, dbCommon.StateReady},
+		{`{"name":"a","state":"creating"}`, false, true, dbCommon.StateReady},
+		{`{"name":"a","state":"nosuch"}`, true, true, dbCommon.StateReady},
+		{`{"name":"a","state":"updating","version":1}`, false, true, dbCommon.StateReady},
+		{`{"name":"a","state":"updating","version":2}`, false, false, dbCommon.StateUpdating},
+		{`{"name":"a","state":"destroyed"}`, false, true, dbCommon.StateUpdating},
+		{`{"name":"a","state":"destroyed"}`, true, false, dbCommon.StateDestroyed},
+		{`{"name":"a"}`, false, true, dbCommon.StateDestroyed},
+	}
+	for i, s := range steps {
+		err := l.SetState(s.json, dbCommon.Opts{Owner: "ci", Force: s.force})
+		if (err != nil) != s.err {
+			t.Errorf("step %d: error = %v, want error %v", i, err, s.err)
+		}
+		if r := getRow(t, l, "a"); r.State != s.state {
+			t.Errorf("step %d: state = %s, want %s", i, r.State, s.state)
+		}
+	}
+	err = l.SetState(`{"name":"a","state":"ready","version":1}`, o)
+	if !errors.Is(err, dbCommon.ErrVersion) {
+		t.Errorf("stale version error = %v", err)
+	}
+	err = l.SetState(`{"name":"x","state":"ready"}`, o)
+	if !errors.Is(err, dbCommon.ErrWsNotFound) {
+		t.Errorf("missing workspace error = %v", err)
+	}
+	r := getRow(t, l, "a")
+	if r.Version != 4 {
+		t.Errorf("version = %d, want 4", r.Version)
+	}
+	var states []string
+	err = l.fs.View(func(st *store) error {
+		for _, h := range st.History {
+			states = append(states, h.OldState+">"+h.NewState)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{">creating", "creating>ready", "ready>updating", "updating>destroyed"}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Errorf("history = %v, want %v", states, want)
+	}
+}
+
+func TestLock(t *testing.T) {
+	l := testDB(t)
+	err := l.Create(`{"name":"a"}`, dbCommon.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, bob := dbCommon.Opts{Owner: "alice"}, dbCommon.Opts{Owner: "bob"}
+	if err := l.Lock("a", time.Hour, dbCommon.Opts{}); !errors.Is(err, dbCommon.ErrOwner) {
+		t.Errorf("lock without owner error = %v", err)
+	}
+	if err := l.Lock("x", time.Hour, alice); !errors.Is(err, dbCommon.ErrWsNotFound) {
+		t.Errorf("lock of missing workspace error = %v", err)
+	}
+	if err := l.Lock("a", time.Hour, alice); err != nil {
+		t.Fatal(err)
+	}
+	r := getRow(t, l, "a")
+	if r.LockOwner != "alice" || r.LockExpire == nil || r.Version != 2 {
+		t.Errorf("locked row = %+v", r)
+	}
+	// Lock holder may renew lock and change state, others may not
+	if err := l.Lock("a", time.Hour, alice); err != nil {
+		t.Errorf("renew: %v", err)
+	}
+	for name, err := range map[string]error{
+		"lock":      l.Lock("a", time.Hour, bob),
+		"set state": l.SetState(`{"name":"a","state":"ready"}`, bob),
+		"unlock":    l.Unlock("a", bob),
+		"delete":    l.Delete("a", dbCommon.Opts{Owner: "bob"}),
+	} {
+		if !errors.Is(err, dbCommon.ErrLocked) {
+			t.Errorf("%s by other owner error = %v", name, err)
+		}
+	}
+	if err := l.SetState(`{"name":"a","state":"ready"}`, alice); err != nil {
+		t.Errorf("set state by lock holder: %v", err)
+	}
+	if err := l.Unlock("a", alice); err != nil {
+		t.Fatal(err)
+	}
+	r = getRow(t, l, "a")
+	if r.LockOwner != "" || r.LockExpire != nil {
+		t.Errorf("unlocked row = %+v", r)
+	}
+	// Unlock of unlocked workspace changes nothing
+	if err := l.Unlock("a", bob); err != nil {
+		t.Errorf("unlock of unlocked workspace: %v", err)
+	}
+	if v := getRow(t, l, "a").Version; v != r.Version {
+		t.Errorf("version changed by no-op unlock: %d -> %d", r.Version, v)
+	}
+	// Expired lock does not block others, force ignores lock
+	if err := l.Lock("a", -time.Second, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Lock("a", time.Hour, bob); err != nil {
+		t.Errorf("lock over expired lock: %v", err)
+	}
+	if err := l.Unlock("a", dbCommon.Opts{Owner: "alice", Force: true}); err != nil {
+		t.Errorf("forced unlock: %v", err)
+	}
+}
+
+func TestDeleteArchiveRestore(t *testing.T) {
+	l := testDB(t)
+	o := dbCommon.Opts{Owner: "ci"}
+	for _, name := range []string{"a", "b"} {
+		err := l.Create(fmt.Sprintf(`{"name":%q}`, name), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Delete("a", o); err == nil {
+		t.Error("workspace which is not destroyed is deleted")
+	}
+	if err := l.Archive("x", o); !errors.Is(err, dbCommon.ErrWsNotFound) {
+		t.Errorf("archive of missing workspace error = %v", err)
+	}
+	if err := l.Delete("a", dbCommon.Opts{Owner: "ci", Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"ready", "destroying", "destroyed"} {
+		err := l.SetState(fmt.Sprintf(`{"name":"b","state":%q}`, s), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	archived := getRow(t, l, "b")
+	if err := l.Archive("b", o); err != nil {
+		t.Fatal(err)
+	}
+	rows, history, err := l.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("workspaces left: %+v", rows)
+	}
+	var archive []ArchiveRow
+	err = l.fs.View(func(st *store) error {
+		archive = st.Archive
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive) != 1 || archive[0].Name != "b" || archive[0].ArchiveDate.IsZero() {
+		t.Errorf("archive = %+v", archive)
+	}
+	last := history[len(history)-1]
+	if last.Name != "b" || last.NewState != dbCommon.StateArchived {
+		t.Errorf("last history row = %+v", last)
+	}
+
+	// Restore adds only unknown history rows and keeps existing workspace without overwrite
+	if err := l.Restore(&archived, history, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Restore(&archived, history, false); !errors.Is(err, dbCommon.ErrWsExists) {
+		t.Errorf("restore over existing workspace error = %v", err)
+	}
+	changed := archived
+	changed.State = dbCommon.StateFailed
+	if err := l.Restore(&changed, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if r := getRow(t, l, "b"); r.State != dbCommon.StateFailed {
+		t.Errorf("overwritten state = %s", r.State)
+	}
+	_, restored, err := l.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != len(history) {
+		t.Errorf("%d history rows after restore, want %d", len(restored), len(history))
+	}
+}
+
+func TestFind(t *testing.T) {
+	l := testDB(t)
+	for _, j := range []string{`{"name":"prod-a","ha_mode":true}`, `{"name":"prod-b"}`, `{"name":"dev-a"}`} {
+		err := l.Create(j, dbCommon.Opts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := l.SetState(`{"name":"prod-b","state":"ready"}`, dbCommon.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ha := true
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name   string
+		filter dbCommon.Filter
+		want   []string
+	}{
+		{"all", dbCommon.Filter{}, []string{"dev-a", "prod-a", "prod-b"}},
+		{"prefix", dbCommon.Filter{NamePrefix: "prod-"}, []string{"prod-a", "prod-b"}},
+		{"state", dbCommon.Filter{State: dbCommon.StateReady}, []string{"prod-b"}},
+		{"ha", dbCommon.Filter{HaMode: &ha}, []string{"prod-a"}},
+		{"created after", dbCommon.Filter{CreatedAfter: &future}, nil},
+		{"updated before", dbCommon.Filter{UpdatedBefore: &future}, []string{"dev-a", "prod-a", "prod-b"}},
+	}
+	for _, tt := range tests {
+		rows, err := l.Find(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range rows {
+			names = append(names, r.Name)
+		}
+		sort.Strings(names)
+		if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, names, tt.want)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	fs := &FileStore{Path: filepath.Join(dir, "state.json")}
+	ok, err := fs.Exists()
+	if err != nil || ok {
+		t.Fatalf("Exists of new store = %v, %v", ok, err)
+	}
+	// Failed update does not save state
+	errFail := errors.New("fail")
+	err = fs.Update(func(st *store) error {
+		st.Workspaces["a"] = dbCommon.WsRow{Name: "a"}
+		return errFail
+	})
+	if err != errFail {
+		t.Fatalf("update error = %v", err)
+	}
+	if ok, _ := fs.Exists(); ok {
+		t.Fatal("state is saved by failed update")
+	}
+	err = fs.Update(func(st *store) error {
+		if st.SchemaVersion != dbCommon.SchemaVersion {
+			t.Errorf("new state schema version = %d", st.SchemaVersion)
+		}
+		st.Workspaces["a"] = dbCommon.WsRow{Name: "a"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(fs.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("state file mode = %v", info.Mode().Perm())
+	}
+	// Only state and lock files are left, temp file is renamed
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	if fmt.Sprint(names) != "[state.json state.json.lock]" {
+		t.Errorf("files = %v", names)
+	}
+	// Exclusive lock blocks readers until released
+	l, err := fs.lock(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		fs.View(func(st *store) error { return nil })
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("view is not blocked by exclusive lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("view is blocked after lock is released")
+	}
+}
+
+func TestLegacyStateFile(t *testing.T) {
+	l := testDB(t)
+	err := ioutil.WriteFile(l.fs.Path, []byte(`{"workspaces":{"a":{"name":"a","net_id":5}}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := l.SchemaVersion()
+	if err != nil || version != 2 {
+		t.Fatalf("legacy schema version = %d, %v", version, err)
+	}
+	applied, err := l.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) < 1 {
+		t.Error("no migrations applied")
+	}
+	version, err = l.SchemaVersion()
+	if err != nil || version != dbCommon.SchemaVersion {
+		t.Errorf("migrated schema version = %d, %v", version, err)
+	}
+	if r := getRow(t, l, "a"); r.NetId != 5 {
+		t.Errorf("row is changed by migration: %+v", r)
+	}
+}
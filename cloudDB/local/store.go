@@ -0,0 +1,125 @@
+package local
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+	"ya-ansible-inventory/common"
+)
+
+// store is the whole state file content
+type store struct {
+	SchemaVersion uint32                    `json:"schema_version"`
+	Workspaces    map[string]dbCommon.WsRow `json:"workspaces"`
+	History       []dbCommon.HistoryRow     `json:"history"`
+	Archive       []ArchiveRow              `json:"archive"`
+}
+
+type ArchiveRow struct {
+	dbCommon.WsRow
+	ArchiveDate time.Time `json:"archive_date"`
+}
+
+// FileStore keeps state in JSON file, access is serialized by flock on side lock file
+type FileStore struct {
+	Path string
+}
+
+// lock takes exclusive or shared flock, returned file must be closed to release lock
+func (fs *FileStore) lock(exclusive bool) (*os.File, error) {
+	f, err := os.OpenFile(fs.Path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	err = syscall.Flock(int(f.Fd()), how)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// load reads state, new state file gets current schema version
+func (fs *FileStore) load() (*store, error) {
+	st := &store{SchemaVersion: dbCommon.SchemaVersion, Workspaces: map[string]dbCommon.WsRow{}}
+	b, err := ioutil.ReadFile(fs.Path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 1 {
+		return st, nil
+	}
+	st.SchemaVersion = 0
+	err = json.Unmarshal(b, st)
+	if err != nil {
+		return nil, err
+	}
+	if st.Workspaces == nil {
+		st.Workspaces = map[string]dbCommon.WsRow{}
+	}
+	// State files without marker are written by first local backend release
+	if st.SchemaVersion == 0 {
+		st.SchemaVersion = 2
+	}
+	return st, nil
+}
+
+// save writes state to temp file and renames it, so readers never see partial file
+func (fs *FileStore) save(st *store) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return common.WriteFileAtomic(fs.Path, b, 0600)
+}
+
+// Exists reports whether state file is created
+func (fs *FileStore) Exists() (bool, error) {
+	_, err := os.Stat(fs.Path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// View reads state under shared lock
+func (fs *FileStore) View(fn func(st *store) error) error {
+	l, err := fs.lock(false)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	st, err := fs.load()
+	if err != nil {
+		return err
+	}
+	return fn(st)
+}
+
+// Update modifies state under exclusive lock, state is saved only if fn succeeds
+func (fs *FileStore) Update(fn func(st *store) error) error {
+	l, err := fs.lock(true)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	st, err := fs.load()
+	if err != nil {
+		return err
+	}
+	err = fn(st)
+	if err != nil {
+		return err
+	}
+	return fs.save(st)
+}
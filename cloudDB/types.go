@@ -1,26 +1,82 @@
 package cloudDB
 
 import (
+	"errors"
 	"fmt"
-	"ya-ansible-inventory/cloud"
+	"os"
+	"time"
+	"ya-ansible-inventory/cloudDB/dbCommon"
 	"ya-ansible-inventory/cloudDB/dynamoDB"
+	"ya-ansible-inventory/cloudDB/local"
 	"ya-ansible-inventory/cloudDB/ydb"
+	"ya-ansible-inventory/config"
+)
+
+var (
+	errNoBackend = errors.New("You must set this ENVs: STATE_BACKEND or CLOUD_TYPE")
 )
 
 type CloudDB interface {
-	List() error
-	Create(string) error
-	SetState(string) error
+	List(dbCommon.Filter, string) error
+	Find(dbCommon.Filter) ([]dbCommon.WsRow, error)
+	Create(string, dbCommon.Opts) error
+	SetState(string, dbCommon.Opts) error
+	Lock(string, time.Duration, dbCommon.Opts) error
+	Unlock(string, dbCommon.Opts) error
+	History(string) error
+	Delete(string, dbCommon.Opts) error
+	Archive(string, dbCommon.Opts) error
+	Dump() ([]dbCommon.WsRow, []dbCommon.HistoryRow, error)
+	Restore(*dbCommon.WsRow, []dbCommon.HistoryRow, bool) error
+	SchemaVersion() (uint32, error)
+	Migrate() ([]dbCommon.Migration, error)
+	RepairDates() (int, error)
 	Close()
 }
 
-func MakeCloudDB(cl cloud.Cloud, t string) (CloudDB, error) {
+// Requirements returns settings of backend type, unknown type is reported by MakeCloudDB
+func Requirements(t string) []config.Requirement {
+	switch t {
+	case "yandex", "yacloud", "ydb":
+		return ydb.Requirements()
+	case "aws", "dynamodb":
+		return []config.Requirement{{"AWS_TABLE"}}
+	case "local":
+		return []config.Requirement{{"LOCAL_DB"}}
+	default:
+		return nil
+	}
+}
+
+func MakeCloudDB(t string) (CloudDB, error) {
 	switch t {
 	case "yandex", "yacloud", "ydb":
-		return ydb.MakeCloudDBYandex(cl)
-	case "aws":
-		return dynamoDB.MakeCloudDBAWS(cl)
+		return ydb.MakeCloudDBYandex()
+	case "aws", "dynamodb":
+		return dynamoDB.MakeCloudDBAWS()
+	case "local":
+		return local.MakeCloudDBLocal()
 	default:
 		return nil, fmt.Errorf("Not have implemented yet")
 	}
 }
+
+// BackendFromEnv returns state backend type from STATE_BACKEND env,
+// backend of the CLOUD_TYPE cloud is used if it is not set
+func BackendFromEnv() (string, error) {
+	for _, e := range []string{"STATE_BACKEND", "CLOUD_TYPE"} {
+		if t := os.Getenv(e); len(t) > 0 {
+			return t, nil
+		}
+	}
+	return "", errNoBackend
+}
+
+// CheckSchema refuses registries with schema newer or older than this binary understands
+func CheckSchema(db CloudDB) error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	return dbCommon.CheckSchema(version)
+}
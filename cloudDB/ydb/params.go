@@ -0,0 +1,82 @@
+package ydb
+
+import (
+	"fmt"
+	"github.com/yandex-cloud/ydb-go-sdk"
+	"github.com/yandex-cloud/ydb-go-sdk/table"
+	"sort"
+	"strings"
+	"time"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+)
+
+// queryParams collects typed query parameters with their DECLARE statements
+type queryParams struct {
+	declares []string
+	opts     []table.ParameterOption
+	err      error
+}
+
+// add declares parameter $name with type deduced from v and returns parameter name for query text
+func (qp *queryParams) add(name string, v interface{}) string {
+	pName := "$" + name
+	var typeName string
+	var value ydb.Value
+	switch t := v.(type) {
+	case string:
+		typeName, value = "String", ydb.StringValue([]byte(t))
+	case bool:
+		typeName, value = "Bool", ydb.BoolValue(t)
+	case uint32:
+		typeName, value = "Uint32", ydb.Uint32Value(t)
+	case uint64:
+		typeName, value = "Uint64", ydb.Uint64Value(t)
+	case time.Time:
+		typeName, value = "Timestamp", ydb.TimestampValue(uint64(dbCommon.CanonicalTime(t).UnixNano()/1000))
+	default:
+		qp.err = fmt.Errorf("%w: %s %T", errDBBadParam, name, v)
+		return pName
+	}
+	qp.declares = append(qp.declares, fmt.Sprintf("DECLARE %s AS %s;", pName, typeName))
+	qp.opts = append(qp.opts, table.ValueParam(pName, value))
+	return pName
+}
+
+// fields returns "k = $k" expressions joined by spliter, nil values are set as NULL
+func (qp *queryParams) fields(m map[string]interface{}, spliter string) string {
+	var exprs []string
+	for _, k := range sortedKeys(m) {
+		if m[k] == nil {
+			exprs = append(exprs, fmt.Sprintf("%s = NULL", k))
+			continue
+		}
+		exprs = append(exprs, fmt.Sprintf("%s = %s", k, qp.add(k, m[k])))
+	}
+	return strings.Join(exprs, spliter)
+}
+
+func (qp *queryParams) declare() string {
+	if len(qp.declares) < 1 {
+		return ""
+	}
+	return strings.Join(qp.declares, "\n") + "\n"
+}
+
+func (qp *queryParams) params() *table.QueryParameters {
+	return table.NewQueryParameters(qp.opts...)
+}
+
+// sortedKeys keeps query text stable, so prepared statements cache stays effective
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// timestampTime converts YDB Timestamp microseconds to canonical time
+func timestampTime(us uint64) time.Time {
+	return dbCommon.CanonicalTime(time.Unix(0, int64(us)*1000))
+}
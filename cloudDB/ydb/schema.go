@@ -0,0 +1,173 @@
+package ydb
+
+import (
+	"context"
+	"fmt"
+	"github.com/yandex-cloud/ydb-go-sdk"
+	"github.com/yandex-cloud/ydb-go-sdk/table"
+	"path"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+)
+
+const (
+	stateIndexName = "state_idx"
+	// schemaKey is the name of meta table row with schema version
+	schemaKey = "schema"
+)
+
+func metaTableOptions() []table.CreateTableOption {
+	return []table.CreateTableOption{
+		table.WithColumn("name", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("version", ydb.Optional(ydb.TypeUint32)),
+		table.WithPrimaryKeyColumn("name"),
+	}
+}
+
+// migrations upgrade tables created by older releases, every step must tolerate partially applied changes
+func (y *YDBConn) migrations() []dbCommon.Migration {
+	return []dbCommon.Migration{
+		{Version: 2, Name: "add version and lock columns, history table", Apply: y.migrateLocks},
+		{Version: 3, Name: "add index on state", Apply: y.migrateStateIndex},
+	}
+}
+
+func (y *YDBConn) migrateLocks() error {
+	err := y.addMissingColumns(y.TableName, map[string]interface{}{
+		"version":     ydb.Optional(ydb.TypeUint64),
+		"lock_owner":  ydb.Optional(ydb.TypeString),
+		"lock_expire": ydb.Optional(ydb.TypeTimestamp),
+	})
+	if err != nil {
+		return err
+	}
+	err = y.write(fmt.Sprintf("UPDATE %s SET version = 1 WHERE version IS NULL ;", y.TableName), &queryParams{})
+	if err != nil {
+		return err
+	}
+	return y.createMissingTable(y.HistoryTableName, historyTableOptions()...)
+}
+
+func (y *YDBConn) migrateStateIndex() error {
+	ok, err := y.indexExists(y.TableName, stateIndexName)
+	if err != nil || ok {
+		return err
+	}
+	return y.retry(func(ctx context.Context, s *table.Session) error {
+		return s.ExecuteSchemeQuery(ctx,
+			fmt.Sprintf("ALTER TABLE `%s` ADD INDEX %s GLOBAL ON (state) ;", y.TableName, stateIndexName))
+	})
+}
+
+// Migrate upgrades registry schema to current version, missing registry is created
+func (y *YDBConn) Migrate() ([]dbCommon.Migration, error) {
+	version, err := y.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, y.CreateTable()
+	}
+	err = y.createMissingTable(y.MetaTableName, metaTableOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return dbCommon.Migrate(version, y.migrations(), y.SetSchemaVersion)
+}
+
+// SchemaVersion returns registry schema version, 0 if registry does not exist.
+// Tables without meta table are created by first releases
+func (y *YDBConn) SchemaVersion() (uint32, error) {
+	ok, err := y.tableExists(y.TableName)
+	if err != nil || !ok {
+		return 0, err
+	}
+	ok, err = y.tableExists(y.MetaTableName)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 1, nil
+	}
+	qp := &queryParams{}
+	q := fmt.Sprintf("SELECT version FROM %s WHERE name = %s ;", y.MetaTableName, qp.add("name", schemaKey))
+	var version uint32 = 1
+	err = y.query(q, qp, func(res *table.Result) {
+		for res.NextSet() {
+			for res.NextRow() {
+				res.SeekItem("version")
+				version = res.OUint32()
+			}
+		}
+	})
+	return version, err
+}
+
+func (y *YDBConn) SetSchemaVersion(version uint32) error {
+	qp := &queryParams{}
+	q := fmt.Sprintf("UPSERT INTO %s (name, version) VALUES (%s, %s) ;",
+		y.MetaTableName, qp.add("name", schemaKey), qp.add("version", version))
+	return y.write(q, qp)
+}
+
+func (y *YDBConn) tableExists(name string) (bool, error) {
+	dbPath, err := y.getDBPath()
+	if err != nil {
+		return false, err
+	}
+	err = y.retry(func(ctx context.Context, s *table.Session) error {
+		_, err := s.DescribeTable(ctx, path.Join(dbPath, name))
+		return err
+	})
+	if ydb.IsOpError(err, ydb.StatusSchemeError) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// indexExists describes implementation table of secondary index, table description
+// of the SDK does not list indexes
+func (y *YDBConn) indexExists(tableName, index string) (bool, error) {
+	return y.tableExists(path.Join(tableName, index, "indexImplTable"))
+}
+
+func (y *YDBConn) createMissingTable(name string, opts ...table.CreateTableOption) error {
+	ok, err := y.tableExists(name)
+	if err != nil || ok {
+		return err
+	}
+	dbPath, err := y.getDBPath()
+	if err != nil {
+		return err
+	}
+	return y.retry(func(ctx context.Context, s *table.Session) error {
+		return s.CreateTable(ctx, path.Join(dbPath, name), opts...)
+	})
+}
+
+func (y *YDBConn) addMissingColumns(name string, columns map[string]interface{}) error {
+	dbPath, err := y.getDBPath()
+	if err != nil {
+		return err
+	}
+	var desc table.Description
+	err = y.retry(func(ctx context.Context, s *table.Session) error {
+		desc, err = s.DescribeTable(ctx, path.Join(dbPath, name))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range desc.Columns {
+		delete(columns, c.Name)
+	}
+	if len(columns) < 1 {
+		return nil
+	}
+	var opts []table.AlterTableOption
+	for _, c := range sortedKeys(columns) {
+		opts = append(opts, table.WithAddColumn(c, columns[c].(ydb.Type)))
+	}
+	return y.retry(func(ctx context.Context, s *table.Session) error {
+		return s.AlterTable(ctx, path.Join(dbPath, name), opts...)
+	})
+}
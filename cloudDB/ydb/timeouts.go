@@ -0,0 +1,45 @@
+package ydb
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Timeouts of YDB connection, zero request and operation timeouts are not limited
+type Timeouts struct {
+	Dial       time.Duration
+	Request    time.Duration
+	Operation  time.Duration
+	MaxRetries int
+}
+
+// timeoutsFromEnv reads YDB_DIAL_TIMEOUT (10s by default), YDB_REQUEST_TIMEOUT,
+// YDB_OPERATION_TIMEOUT durations and YDB_MAX_RETRIES of retriable errors (10 by default)
+func timeoutsFromEnv() (Timeouts, error) {
+	t := Timeouts{Dial: 10 * time.Second, MaxRetries: 10}
+	for env, dst := range map[string]*time.Duration{
+		"YDB_DIAL_TIMEOUT":      &t.Dial,
+		"YDB_REQUEST_TIMEOUT":   &t.Request,
+		"YDB_OPERATION_TIMEOUT": &t.Operation,
+	} {
+		v := os.Getenv(env)
+		if len(v) < 1 {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return t, fmt.Errorf("%s must be positive duration: %q", env, v)
+		}
+		*dst = d
+	}
+	if v := os.Getenv("YDB_MAX_RETRIES"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return t, fmt.Errorf("YDB_MAX_RETRIES must be positive number: %q", v)
+		}
+		t.MaxRetries = n
+	}
+	return t, nil
+}
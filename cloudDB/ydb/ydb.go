@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	iamv1 "github.com/yandex-cloud/go-genproto/yandex/cloud/iam/v1"
 	ycsdk "github.com/yandex-cloud/go-sdk"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 	"ya-ansible-inventory/cloud"
+	"ya-ansible-inventory/cloud/yandex"
+	"ya-ansible-inventory/cloudDB/dbCommon"
 	"ya-ansible-inventory/common"
+	"ya-ansible-inventory/config"
 )
 
 var (
@@ -18,47 +22,92 @@ var (
 	errSetState   = errors.New("Set state. Must set ws Name and ws State")
 )
 
-func MakeCloudDBYandex(cl cloud.Cloud) (*CdbYandex, error) {
+// MakeCloudDBYandex connects to YDB given by YDB_ENDPOINT and YDB_DATABASE envs,
+// database is discovered by YC_DB name in FOLDER_ID folder if endpoint is not set
+func MakeCloudDBYandex() (*CdbYandex, error) {
 	ctx := context.TODO()
-	envLabels := []string{"YC_TOKEN", "FOLDER_ID", "YC_DB"}
-	envs, err := common.CheckEnvs(envLabels)
+	creds, err := yandex.CredentialsFromEnv()
 	if err != nil {
-		return nil, fmt.Errorf("You must set this ENVs: %s", strings.Join(envLabels, ", "))
+		return nil, err
 	}
 	client, err := ycsdk.Build(ctx, ycsdk.Config{
-		Credentials: ycsdk.OAuthToken(envs["YC_TOKEN"]),
+		Credentials: creds,
 	})
 	if err != nil {
 		return nil, err
 	}
-	dbs, err := cl.GetDBs(&cloud.NameFilter{NameEqual: envs["YC_DB"]})
+	dbName, endpoint, err := ydbEndpoint()
 	if err != nil {
 		return nil, err
 	}
-	if len(dbs) < 1 {
-		return nil, fmt.Errorf("DBs not found")
+	netIds, err := dbCommon.NetIdRangeFromEnv()
+	if err != nil {
+		return nil, err
 	}
-	iam, err := client.IAM().IamToken().Create(ctx, &iamv1.CreateIamTokenRequest{Identity: &iamv1.CreateIamTokenRequest_YandexPassportOauthToken{YandexPassportOauthToken: envs["YC_TOKEN"]}})
+	timeouts, err := timeoutsFromEnv()
 	if err != nil {
 		return nil, err
 	}
 	conn := &YDBConn{
-		DatabaseName: dbs[0].GetName(),
-		TableName:    "main",
-		IAMtoken:     iam.IamToken,
-		Endpoint:     dbs[0].GetEndpoint(),
-		CTX:          context.Background(),
+		DatabaseName:     dbName,
+		TableName:        "main",
+		HistoryTableName: "history",
+		ArchiveTableName: "archive",
+		MetaTableName:    "meta",
+		NetIds:           netIds,
+		Credentials:      yandex.NewIAMTokenSource(client),
+		Endpoint:         endpoint,
+		Timeouts:         timeouts,
+		CTX:              context.Background(),
 	}
-	return &CdbYandex{api: client, conn: conn, folderId: envs["FOLDER_ID"]}, nil
+	return &CdbYandex{api: client, conn: conn, folderId: os.Getenv("FOLDER_ID")}, nil
 }
 
-type WsRow struct {
-	Name       string    `json:"name"`
-	NetId      uint32    `json:"net_id"`
-	CreateDate time.Time `json:"create_date"`
-	UpdateDate time.Time `json:"update_date"`
-	State      string    `json:"state"`
-	HaMode     bool      `json:"ha_mode"`
+// Requirements are credentials and database given by endpoint or name in folder
+func Requirements() []config.Requirement {
+	reqs := []config.Requirement{yandex.CredentialsRequirement}
+	if len(os.Getenv("YDB_ENDPOINT")) > 0 {
+		return append(reqs, config.Requirement{"YDB_DATABASE"})
+	}
+	return append(reqs, config.Requirement{"FOLDER_ID"}, config.Requirement{"YC_DB"})
+}
+
+// ydbEndpoint returns database name and endpoint with database path in query
+func ydbEndpoint() (string, string, error) {
+	endpoint := os.Getenv("YDB_ENDPOINT")
+	if len(endpoint) > 0 {
+		envLabels := []string{"YDB_DATABASE"}
+		envs, err := common.CheckEnvs(envLabels)
+		if err != nil {
+			return "", "", fmt.Errorf("You must set this ENVs with YDB_ENDPOINT: %s", strings.Join(envLabels, ", "))
+		}
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "grpcs://" + endpoint
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", "", err
+		}
+		u.RawQuery = url.Values{"database": []string{envs["YDB_DATABASE"]}}.Encode()
+		return envs["YDB_DATABASE"], u.String(), nil
+	}
+	envLabels := []string{"FOLDER_ID", "YC_DB"}
+	envs, err := common.CheckEnvs(envLabels)
+	if err != nil {
+		return "", "", fmt.Errorf("You must set YDB_ENDPOINT or this ENVs: %s", strings.Join(envLabels, ", "))
+	}
+	cl, err := yandex.MakeCloudYandex()
+	if err != nil {
+		return "", "", err
+	}
+	dbs, err := cl.GetDBs(&cloud.NameFilter{NameEqual: envs["YC_DB"]})
+	if err != nil {
+		return "", "", err
+	}
+	if len(dbs) < 1 {
+		return "", "", errDBnotFound
+	}
+	return dbs[0].GetName(), dbs[0].GetEndpoint(), nil
 }
 
 type CdbYandex struct {
@@ -74,8 +123,24 @@ func (y *CdbYandex) Close() {
 	}
 }
 
-func (y *CdbYandex) List() error {
-	r, err := y.conn.Select(nil)
+func (y *CdbYandex) List(f dbCommon.Filter, format string) error {
+	r, err := y.Find(f)
+	if err != nil {
+		return err
+	}
+	return dbCommon.WriteRows(os.Stdout, r, format)
+}
+
+func (y *CdbYandex) Find(f dbCommon.Filter) ([]dbCommon.WsRow, error) {
+	r, err := y.conn.Find(f)
+	if err != nil {
+		return nil, err
+	}
+	return *r, nil
+}
+
+func (y *CdbYandex) History(name string) error {
+	r, err := y.conn.SelectHistory(name)
 	if err != nil {
 		return err
 	}
@@ -87,28 +152,40 @@ func (y *CdbYandex) List() error {
 	return nil
 }
 
-func (y *CdbYandex) Create(j string) error {
-	inRow := WsRow{}
+func (y *CdbYandex) Create(j string, o dbCommon.Opts) error {
+	inRow := dbCommon.WsRow{}
 	err := json.Unmarshal([]byte(j), &inRow)
 	if err != nil {
 		return err
 	}
-	inRow.State = "creating"
-	inRow.CreateDate = time.Now()
-	inRow.UpdateDate = time.Now()
+	inRow.State = dbCommon.StateCreating
+	inRow.CreateDate = dbCommon.Now()
+	inRow.UpdateDate = dbCommon.Now()
+	inRow.Version = 1
+	inRow.LockOwner = ""
+	inRow.LockExpire = nil
 	err = y.conn.CreateTable()
 	if err != nil {
 		return err
 	}
-	err = y.conn.Insert(inRow)
+	netIdGiven, err := dbCommon.NetIdGiven(j)
+	if err != nil {
+		return err
+	}
+	err = y.conn.Insert(&inRow, !netIdGiven, dbCommon.NewHistoryRow(inRow.Name, "", inRow.State, o))
+	if err != nil {
+		return err
+	}
+	s, err := common.StringDumpErr(inRow)
 	if err != nil {
 		return err
 	}
+	fmt.Println(s)
 	return nil
 }
 
-func (y *CdbYandex) SetState(j string) error {
-	inRow := WsRow{}
+func (y *CdbYandex) SetState(j string, o dbCommon.Opts) error {
+	inRow := dbCommon.WsRow{}
 	err := json.Unmarshal([]byte(j), &inRow)
 	if err != nil {
 		return err
@@ -116,15 +193,137 @@ func (y *CdbYandex) SetState(j string) error {
 	if len(inRow.Name) < 1 || len(inRow.State) < 1 {
 		return errSetState
 	}
-	err = y.conn.Set(map[string]interface{}{
+	cur, err := y.conn.Get(inRow.Name)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckVersion(inRow.Version, cur.Version)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckTransition(cur.State, inRow.State, o.Force)
+	if err != nil {
+		return err
+	}
+	return y.conn.Set(inRow.Name, cur.Version, map[string]interface{}{
 		"state": inRow.State,
-	},
-		map[string]interface{}{
-			"name": inRow.Name,
-		},
-	)
+	}, dbCommon.NewHistoryRow(inRow.Name, cur.State, inRow.State, o))
+}
+
+func (y *CdbYandex) Lock(name string, ttl time.Duration, o dbCommon.Opts) error {
+	if len(o.Owner) < 1 {
+		return dbCommon.ErrOwner
+	}
+	cur, err := y.conn.Get(name)
 	if err != nil {
 		return err
 	}
-	return nil
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	return y.conn.Set(name, cur.Version, map[string]interface{}{
+		"lock_owner":  o.Owner,
+		"lock_expire": dbCommon.Now().Add(ttl),
+	}, nil)
+}
+
+func (y *CdbYandex) Unlock(name string, o dbCommon.Opts) error {
+	cur, err := y.conn.Get(name)
+	if err != nil {
+		return err
+	}
+	if len(cur.LockOwner) < 1 {
+		return nil
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	return y.conn.Set(name, cur.Version, map[string]interface{}{
+		"lock_owner":  nil,
+		"lock_expire": nil,
+	}, nil)
+}
+
+func (y *CdbYandex) Delete(name string, o dbCommon.Opts) error {
+	cur, err := y.conn.Get(name)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckRemove(cur.State, o.Force)
+	if err != nil {
+		return err
+	}
+	return y.conn.Delete(name, cur.Version, dbCommon.NewHistoryRow(name, cur.State, dbCommon.StateDeleted, o))
+}
+
+func (y *CdbYandex) Archive(name string, o dbCommon.Opts) error {
+	cur, err := y.conn.Get(name)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckLock(cur.LockOwner, cur.LockExpire, o)
+	if err != nil {
+		return err
+	}
+	err = dbCommon.CheckRemove(cur.State, o.Force)
+	if err != nil {
+		return err
+	}
+	err = y.conn.CreateArchiveTable()
+	if err != nil {
+		return err
+	}
+	return y.conn.Archive(name, cur.Version, dbCommon.NewHistoryRow(name, cur.State, dbCommon.StateArchived, o))
+}
+
+func (y *CdbYandex) Dump() ([]dbCommon.WsRow, []dbCommon.HistoryRow, error) {
+	rows, err := y.conn.Select(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	history, err := y.conn.SelectHistory("")
+	if err != nil {
+		return nil, nil, err
+	}
+	return *rows, *history, nil
+}
+
+func (y *CdbYandex) Restore(r *dbCommon.WsRow, history []dbCommon.HistoryRow, overwrite bool) error {
+	err := y.conn.CreateTable()
+	if err != nil {
+		return err
+	}
+	if r != nil && !overwrite {
+		_, err = y.conn.Get(r.Name)
+		if err == nil {
+			return dbCommon.ErrWsExists
+		}
+		if err != dbCommon.ErrWsNotFound {
+			return err
+		}
+	}
+	return y.conn.Restore(r, history)
+}
+
+func (y *CdbYandex) SchemaVersion() (uint32, error) {
+	return y.conn.SchemaVersion()
+}
+
+func (y *CdbYandex) Migrate() ([]dbCommon.Migration, error) {
+	return y.conn.Migrate()
+}
+
+// RepairDates has nothing to repair: YDB timestamp columns can't keep legacy text encodings
+func (y *CdbYandex) RepairDates() (int, error) {
+	return 0, nil
 }
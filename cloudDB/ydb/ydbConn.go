@@ -7,29 +7,49 @@ import (
 	"fmt"
 	"github.com/yandex-cloud/ydb-go-sdk"
 	"github.com/yandex-cloud/ydb-go-sdk/table"
-	"log"
 	"net/url"
-	"path"
-	"time"
+	"strings"
+	"sync"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+)
+
+const (
+	wsColumns = "name,net_id,ha_mode,state,create_date,update_date,version,lock_owner,lock_expire"
 )
 
 var (
 	errDBBadEndpoint     = errors.New("Database have bad endpoint")
 	errDBBadSetOperation = errors.New("Set args error")
+	errDBBadParam        = errors.New("Unsupported query parameter type")
 )
 
 type YDBConn struct {
-	DatabaseName string
-	TableName    string
-	IAMtoken     string
-	Endpoint     string
-	CTX          context.Context
-	session      *table.Session
+	DatabaseName     string
+	TableName        string
+	HistoryTableName string
+	ArchiveTableName string
+	MetaTableName    string
+	NetIds           dbCommon.NetIdRange
+	// Credentials issue IAM token of each request, token is refreshed on expiration
+	Credentials ydb.Credentials
+	Endpoint    string
+	Timeouts    Timeouts
+	CTX         context.Context
+	mu          sync.Mutex
+	driver      ydb.Driver
+	pool        *table.SessionPool
 }
 
 func (y *YDBConn) Close() {
-	if y.session != nil {
-		y.session.Close(y.CTX)
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if y.pool != nil {
+		y.pool.Close(y.CTX)
+		y.pool = nil
+	}
+	if y.driver != nil {
+		y.driver.Close()
+		y.driver = nil
 	}
 }
 
@@ -59,153 +79,491 @@ func (y *YDBConn) getDBAddress() (string, error) {
 	return u.Host, nil
 }
 
-func (y *YDBConn) newSession() error {
+// connect dials database and creates session pool on first use
+func (y *YDBConn) connect() (*table.SessionPool, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	if y.pool != nil {
+		return y.pool, nil
+	}
 	dbPath, err := y.getDBPath()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	dbAddr, err := y.getDBAddress()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	dialer := &ydb.Dialer{
 		DriverConfig: &ydb.DriverConfig{
-			Database: dbPath,
-			Credentials: ydb.AuthTokenCredentials{
-				AuthToken: y.IAMtoken,
-			},
+			Database:         dbPath,
+			Credentials:      y.Credentials,
+			RequestTimeout:   y.Timeouts.Request,
+			OperationTimeout: y.Timeouts.Operation,
 		},
 		TLSConfig: &tls.Config{ /*...*/ },
-		Timeout:   time.Second,
+		Timeout:   y.Timeouts.Dial,
 	}
 	driver, err := dialer.Dial(y.CTX, dbAddr)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	tc := table.Client{
-		Driver: driver,
+	y.driver = driver
+	y.pool = &table.SessionPool{
+		Builder: &table.Client{
+			Driver: driver,
+		},
 	}
-	s, err := tc.CreateSession(y.CTX)
+	return y.pool, nil
+}
+
+// retry runs op on pooled session, op is repeated on retriable errors: BAD_SESSION is retried
+// on new session, OVERLOADED after backoff. Op must not wrap ydb errors
+func (y *YDBConn) retry(op func(context.Context, *table.Session) error) error {
+	pool, err := y.connect()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	return table.Retryer{
+		SessionProvider: pool,
+		MaxRetries:      y.Timeouts.MaxRetries,
+		RetryChecker:    ydb.DefaultRetryChecker,
+		Backoff:         ydb.DefaultBackoff,
+	}.Do(y.CTX, table.OperationFunc(op))
+}
+
+// execute runs query with prepared statement, statements are cached by session
+func (y *YDBConn) execute(ctx context.Context, s *table.Session, txc *table.TransactionControl, q string, qp *queryParams) (*table.Transaction, *table.Result, error) {
+	if qp.err != nil {
+		return nil, nil, qp.err
 	}
-	if y.session != nil {
-		y.session.Close(y.CTX)
+	stmt, err := s.Prepare(ctx, qp.declare()+q)
+	if err != nil {
+		return nil, nil, err
 	}
-	y.session = s
-	return nil
+	return stmt.Execute(ctx, txc, qp.params())
 }
 
-func (y *YDBConn) GetSession() *table.Session {
-	if y.session == nil {
-		y.newSession()
+func (y *YDBConn) txExecute(ctx context.Context, tx *table.Transaction, s *table.Session, q string, qp *queryParams) (*table.Result, error) {
+	if qp.err != nil {
+		return nil, qp.err
+	}
+	stmt, err := s.Prepare(ctx, qp.declare()+q)
+	if err != nil {
+		return nil, err
 	}
-	return y.session
+	return tx.ExecuteStatement(ctx, stmt, qp.params())
+}
+
+// write executes query in its own serializable transaction
+func (y *YDBConn) write(q string, qp *queryParams) error {
+	writeTx := table.TxControl(
+		table.BeginTx(
+			table.WithSerializableReadWrite(),
+		),
+		table.CommitTx(),
+	)
+	return y.retry(func(ctx context.Context, s *table.Session) error {
+		_, _, err := y.execute(ctx, s, writeTx, q, qp)
+		return err
+	})
 }
 
+// CreateTable creates registry tables of current schema version if registry does not exist
 func (y *YDBConn) CreateTable() error {
-	dbPath, err := y.getDBPath()
-	if err != nil {
+	version, err := y.SchemaVersion()
+	if err != nil || version > 0 {
 		return err
 	}
-	session := y.GetSession()
-	err = session.CreateTable(y.CTX, path.Join(dbPath, y.TableName),
+	for _, t := range []struct {
+		name string
+		opts []table.CreateTableOption
+	}{
+		{y.TableName, wsTableOptions()},
+		{y.HistoryTableName, historyTableOptions()},
+		{y.MetaTableName, metaTableOptions()},
+	} {
+		err = y.createMissingTable(t.name, t.opts...)
+		if err != nil {
+			return err
+		}
+	}
+	return y.SetSchemaVersion(dbCommon.SchemaVersion)
+}
+
+func wsTableOptions() []table.CreateTableOption {
+	return []table.CreateTableOption{
 		table.WithColumn("name", ydb.Optional(ydb.TypeString)),
 		table.WithColumn("net_id", ydb.Optional(ydb.TypeUint32)),
 		table.WithColumn("create_date", ydb.Optional(ydb.TypeTimestamp)),
 		table.WithColumn("update_date", ydb.Optional(ydb.TypeTimestamp)),
 		table.WithColumn("state", ydb.Optional(ydb.TypeString)),
 		table.WithColumn("ha_mode", ydb.Optional(ydb.TypeBool)),
+		table.WithColumn("version", ydb.Optional(ydb.TypeUint64)),
+		table.WithColumn("lock_owner", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("lock_expire", ydb.Optional(ydb.TypeTimestamp)),
 		table.WithPrimaryKeyColumn("name"),
-	)
-	return err
+		table.WithIndex(stateIndexName, table.WithIndexType(table.GlobalIndex()), table.WithIndexColumns("state")),
+	}
 }
 
-func (y *YDBConn) Insert(r WsRow) error {
-	writeTx := table.TxControl(
+func historyTableOptions() []table.CreateTableOption {
+	return []table.CreateTableOption{
+		table.WithColumn("name", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("date", ydb.Optional(ydb.TypeTimestamp)),
+		table.WithColumn("old_state", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("new_state", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("actor", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("reason", ydb.Optional(ydb.TypeString)),
+		table.WithPrimaryKeyColumn("name", "date"),
+	}
+}
+
+func archiveTableOptions() []table.CreateTableOption {
+	return []table.CreateTableOption{
+		table.WithColumn("name", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("net_id", ydb.Optional(ydb.TypeUint32)),
+		table.WithColumn("create_date", ydb.Optional(ydb.TypeTimestamp)),
+		table.WithColumn("update_date", ydb.Optional(ydb.TypeTimestamp)),
+		table.WithColumn("state", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("ha_mode", ydb.Optional(ydb.TypeBool)),
+		table.WithColumn("version", ydb.Optional(ydb.TypeUint64)),
+		table.WithColumn("lock_owner", ydb.Optional(ydb.TypeString)),
+		table.WithColumn("lock_expire", ydb.Optional(ydb.TypeTimestamp)),
+		table.WithColumn("archive_date", ydb.Optional(ydb.TypeTimestamp)),
+		table.WithPrimaryKeyColumn("name", "archive_date"),
+	}
+}
+
+func (y *YDBConn) CreateArchiveTable() error {
+	return y.createMissingTable(y.ArchiveTableName, archiveTableOptions()...)
+}
+
+func (y *YDBConn) historyQuery(h *dbCommon.HistoryRow, qp *queryParams) string {
+	if h == nil {
+		return ""
+	}
+	return y.historyRowQuery(h, qp, "h_")
+}
+
+func (y *YDBConn) historyRowQuery(h *dbCommon.HistoryRow, qp *queryParams, prefix string) string {
+	return fmt.Sprintf("UPSERT INTO %s (name,date,old_state,new_state,actor,reason) VALUES (%s,%s,%s,%s,%s,%s) ;",
+		y.HistoryTableName, qp.add(prefix+"name", h.Name), qp.add(prefix+"date", h.Date), qp.add(prefix+"old_state", h.OldState),
+		qp.add(prefix+"new_state", h.NewState), qp.add(prefix+"actor", h.Actor), qp.add(prefix+"reason", h.Reason))
+}
+
+// Restore writes row as is with its history records, existing row is replaced.
+// Row may be nil to write history records only
+func (y *YDBConn) Restore(r *dbCommon.WsRow, history []dbCommon.HistoryRow) error {
+	qp := &queryParams{}
+	q := ""
+	if r != nil {
+		fields := map[string]interface{}{
+			"name":        r.Name,
+			"net_id":      r.NetId,
+			"state":       r.State,
+			"ha_mode":     r.HaMode,
+			"create_date": r.CreateDate,
+			"update_date": r.UpdateDate,
+			"version":     r.Version,
+		}
+		if len(r.LockOwner) > 0 && r.LockExpire != nil {
+			fields["lock_owner"] = r.LockOwner
+			fields["lock_expire"] = *r.LockExpire
+		}
+		var columns, values []string
+		for _, k := range sortedKeys(fields) {
+			columns = append(columns, k)
+			values = append(values, qp.add(k, fields[k]))
+		}
+		q = fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s) ;", y.TableName, strings.Join(columns, ","), strings.Join(values, ","))
+	}
+	for i := range history {
+		q += y.historyRowQuery(&history[i], qp, fmt.Sprintf("h%d_", i))
+	}
+	if len(q) < 1 {
+		return nil
+	}
+	return y.write(q, qp)
+}
+
+// Insert adds new row, NetId is checked for duplicates or allocated from NetIds range if autoNetId is set.
+// Row and history record are written in one serializable transaction, concurrent allocation aborts
+// transaction and it is retried
+func (y *YDBConn) Insert(r *dbCommon.WsRow, autoNetId bool, h *dbCommon.HistoryRow) error {
+	return y.retry(func(ctx context.Context, s *table.Session) error {
+		return y.insert(ctx, s, r, autoNetId, h)
+	})
+}
+
+func (y *YDBConn) insert(ctx context.Context, s *table.Session, r *dbCommon.WsRow, autoNetId bool, h *dbCommon.HistoryRow) error {
+	readTx := table.TxControl(
 		table.BeginTx(
 			table.WithSerializableReadWrite(),
 		),
-		table.CommitTx(),
 	)
-	q := fmt.Sprintf("INSERT INTO %s (name,net_id,state,ha_mode,create_date,update_date) values(%q, %d,%q,%v,DateTime::FromSeconds(%d),DateTime::FromSeconds(%d)) ;",
-		y.TableName, r.Name, r.NetId, r.State, r.HaMode, r.CreateDate.Unix(), r.UpdateDate.Unix())
-	sess := y.GetSession()
-	_, _, err := sess.Execute(y.CTX, writeTx, q, nil)
+	q := fmt.Sprintf("SELECT net_id FROM %s ;", y.TableName)
+	tx, res, err := y.execute(ctx, s, readTx, q, &queryParams{})
+	if err != nil {
+		return err
+	}
+	var used []uint32
+	for res.NextSet() {
+		for res.NextRow() {
+			res.SeekItem("net_id")
+			used = append(used, res.OUint32())
+		}
+	}
+	if err = res.Err(); err == nil && autoNetId {
+		r.NetId, err = dbCommon.LowestFreeNetId(used, y.NetIds)
+	} else if err == nil {
+		err = dbCommon.CheckNetId(r.NetId, used)
+	}
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	qp := &queryParams{}
+	q = fmt.Sprintf("INSERT INTO %s (name,net_id,state,ha_mode,create_date,update_date,version) VALUES (%s,%s,%s,%s,%s,%s,%s) ;",
+		y.TableName, qp.add("name", r.Name), qp.add("net_id", r.NetId), qp.add("state", r.State), qp.add("ha_mode", r.HaMode),
+		qp.add("create_date", r.CreateDate), qp.add("update_date", r.UpdateDate), qp.add("version", r.Version))
+	q += y.historyQuery(h, qp)
+	_, err = y.txExecute(ctx, tx, s, q, qp)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	_, err = tx.CommitTx(ctx)
 	return err
 }
 
-func mapToQuery(m map[string]interface{}, spliter string) string {
-	result := ""
-	for k, v := range m {
-		if len(result) > 0 {
-			result += spliter
-		}
-		switch v.(type) {
-		case string:
-			result += fmt.Sprintf("%s = %q", k, v)
-		default:
-			result += fmt.Sprintf("%s = %v", k, v)
-		}
+// Set updates row fields only if row version still equal to version, row version is incremented.
+// History record is written in the same transaction if not nil
+func (y *YDBConn) Set(name string, version uint64, sf map[string]interface{}, h *dbCommon.HistoryRow) error {
+	setFields := map[string]interface{}{
+		"version":     version + 1,
+		"update_date": dbCommon.Now(),
+	}
+	for k, v := range sf {
+		setFields[k] = v
 	}
-	return result
+	qp := &queryParams{}
+	q := fmt.Sprintf("UPDATE %s SET %s WHERE name = %s ;",
+		y.TableName, qp.fields(setFields, ", "), qp.add("name", name))
+	return y.execCAS(name, version, q+y.historyQuery(h, qp), qp)
 }
 
-func (y *YDBConn) Set(sf map[string]interface{}, w map[string]interface{}) error {
-	writeTx := table.TxControl(
+// Delete removes row if row version still equal to version
+func (y *YDBConn) Delete(name string, version uint64, h *dbCommon.HistoryRow) error {
+	qp := &queryParams{}
+	q := fmt.Sprintf("DELETE FROM %s WHERE name = %s ;", y.TableName, qp.add("name", name))
+	return y.execCAS(name, version, q+y.historyQuery(h, qp), qp)
+}
+
+// Archive moves row to archive table if row version still equal to version
+func (y *YDBConn) Archive(name string, version uint64, h *dbCommon.HistoryRow) error {
+	qp := &queryParams{}
+	nameParam := qp.add("name", name)
+	q := fmt.Sprintf("INSERT INTO %s (%s,archive_date) SELECT %s, CurrentUtcTimestamp() AS archive_date FROM %s WHERE name = %s ;",
+		y.ArchiveTableName, wsColumns, wsColumns, y.TableName, nameParam)
+	q += fmt.Sprintf("DELETE FROM %s WHERE name = %s ;", y.TableName, nameParam)
+	return y.execCAS(name, version, q+y.historyQuery(h, qp), qp)
+}
+
+// execCAS executes query in serializable transaction only if row version still equal to version
+func (y *YDBConn) execCAS(name string, version uint64, q string, qp *queryParams) error {
+	return y.retry(func(ctx context.Context, s *table.Session) error {
+		return y.cas(ctx, s, name, version, q, qp)
+	})
+}
+
+func (y *YDBConn) cas(ctx context.Context, s *table.Session, name string, version uint64, q string, qp *queryParams) error {
+	readTx := table.TxControl(
 		table.BeginTx(
 			table.WithSerializableReadWrite(),
 		),
-		table.CommitTx(),
 	)
-	setString := mapToQuery(sf, ", ")
-	where := mapToQuery(w, " AND ")
-	q := fmt.Sprintf("UPDATE %s SET update_date = DateTime::FromSeconds(%d), %s  WHERE %s ;",
-		y.TableName, time.Now().Unix(), setString, where)
-	sess := y.GetSession()
-	_, _, err := sess.Execute(y.CTX, writeTx, q, nil)
-
+	rqp := &queryParams{}
+	rq := fmt.Sprintf("SELECT version FROM %s WHERE name = %s ;", y.TableName, rqp.add("name", name))
+	tx, res, err := y.execute(ctx, s, readTx, rq, rqp)
+	if err != nil {
+		return err
+	}
+	found := false
+	var curVersion uint64
+	for res.NextSet() {
+		for res.NextRow() {
+			res.SeekItem("version")
+			curVersion = res.OUint64()
+			found = true
+		}
+	}
+	if err = res.Err(); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	if !found {
+		tx.Rollback(ctx)
+		return dbCommon.ErrWsNotFound
+	}
+	if curVersion != version {
+		tx.Rollback(ctx)
+		return dbCommon.ErrVersion
+	}
+	_, err = y.txExecute(ctx, tx, s, q, qp)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+	_, err = tx.CommitTx(ctx)
+	// Row is changed by concurrent transaction
+	if ydb.IsOpError(err, ydb.StatusAborted) {
+		return dbCommon.ErrVersion
+	}
 	return err
 }
 
-func (y *YDBConn) Select(w map[string]interface{}) (*[]WsRow, error) {
-	var result []WsRow
-	readTx := table.TxControl(
+func (y *YDBConn) Select(w map[string]interface{}) (*[]dbCommon.WsRow, error) {
+	qp := &queryParams{}
+	where := qp.fields(w, " AND ")
+	q := ""
+	if len(where) > 0 {
+		q = fmt.Sprintf("SELECT %s FROM %s WHERE %s ;", wsColumns, y.TableName, where)
+	} else {
+		q = fmt.Sprintf("SELECT %s FROM %s ;", wsColumns, y.TableName)
+	}
+	return y.selectRows(q, qp)
+}
+
+// Find returns rows passing filter, state is looked up by secondary index
+func (y *YDBConn) Find(f dbCommon.Filter) (*[]dbCommon.WsRow, error) {
+	qp := &queryParams{}
+	from := y.TableName
+	var where []string
+	if len(f.State) > 0 {
+		from = fmt.Sprintf("%s VIEW %s", y.TableName, stateIndexName)
+		where = append(where, "state = "+qp.add("state", f.State))
+	}
+	if len(f.NamePrefix) > 0 {
+		where = append(where, fmt.Sprintf("StartsWith(name, %s)", qp.add("name_prefix", f.NamePrefix)))
+	}
+	if f.HaMode != nil {
+		where = append(where, "ha_mode = "+qp.add("ha_mode", *f.HaMode))
+	}
+	for i, r := range f.Ranges() {
+		where = append(where, fmt.Sprintf("%s %s %s", r.Column, r.Op, qp.add(fmt.Sprintf("range%d", i), *r.Value)))
+	}
+	q := fmt.Sprintf("SELECT %s FROM %s ;", wsColumns, from)
+	if len(where) > 0 {
+		q = fmt.Sprintf("SELECT %s FROM %s WHERE %s ;", wsColumns, from, strings.Join(where, " AND "))
+	}
+	return y.selectRows(q, qp)
+}
+
+// readTx is read only transaction of one query
+func readTx() *table.TransactionControl {
+	return table.TxControl(
 		table.BeginTx(
 			table.WithOnlineReadOnly(),
 		),
 		table.CommitTx(),
 	)
-	sess := y.GetSession()
-	where := mapToQuery(w, " AND ")
-	q := ""
-	if len(where) > 0 {
-		q = fmt.Sprintf("SELECT name,net_id,ha_mode,state,create_date,update_date FROM %s WHERE %s ;", y.TableName, where)
-	} else {
-		q = fmt.Sprintf("SELECT name,net_id,ha_mode,state,create_date,update_date FROM %s ;", y.TableName)
+}
+
+// query runs read only query, scan reads result and is called again if query is retried
+func (y *YDBConn) query(q string, qp *queryParams, scan func(*table.Result)) error {
+	return y.retry(func(ctx context.Context, s *table.Session) error {
+		_, res, err := y.execute(ctx, s, readTx(), q, qp)
+		if err != nil {
+			return err
+		}
+		scan(res)
+		return res.Err()
+	})
+}
+
+func (y *YDBConn) selectRows(q string, qp *queryParams) (*[]dbCommon.WsRow, error) {
+	var result []dbCommon.WsRow
+	err := y.query(q, qp, func(res *table.Result) {
+		result = nil
+		for res.NextSet() {
+			var tmpRow dbCommon.WsRow
+			for res.NextRow() {
+				res.SeekItem("name")
+				tmpRow.Name = string(res.OString())
+				res.NextItem()
+				tmpRow.NetId = res.OUint32()
+				res.NextItem()
+				tmpRow.HaMode = res.OBool()
+				res.NextItem()
+				tmpRow.State = string(res.OString())
+				res.NextItem()
+				tmpRow.CreateDate = timestampTime(res.OTimestamp())
+				res.NextItem()
+				tmpRow.UpdateDate = timestampTime(res.OTimestamp())
+				res.NextItem()
+				tmpRow.Version = res.OUint64()
+				res.NextItem()
+				tmpRow.LockOwner = string(res.OString())
+				res.NextItem()
+				tmpRow.LockExpire = nil
+				if ts := res.OTimestamp(); ts > 0 {
+					lockExpire := timestampTime(ts)
+					tmpRow.LockExpire = &lockExpire
+				}
+				result = append(result, tmpRow)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
+	return &result, nil
+}
 
-	_, res, err := sess.Execute(y.CTX, readTx, q, nil)
+func (y *YDBConn) Get(name string) (*dbCommon.WsRow, error) {
+	rows, err := y.Select(map[string]interface{}{"name": name})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	for res.NextSet() {
-		var tmpRow WsRow
-		for res.NextRow() {
-			res.SeekItem("name")
-			tmpRow.Name = string(res.OString())
-			res.NextItem()
-			tmpRow.NetId = res.OUint32()
-			res.NextItem()
-			tmpRow.HaMode = res.OBool()
-			res.NextItem()
-			tmpRow.State = string(res.OString())
-			res.NextItem()
-			tmpRow.CreateDate = time.Unix(int64(res.OTimestamp())/1000000, 0)
-			res.NextItem()
-			tmpRow.UpdateDate = time.Unix(int64(res.OTimestamp())/1000000, 0)
-			result = append(result, tmpRow)
+	if len(*rows) < 1 {
+		return nil, dbCommon.ErrWsNotFound
+	}
+	return &(*rows)[0], nil
+}
+
+// SelectHistory returns history of workspace, history of all workspaces is returned for empty name
+func (y *YDBConn) SelectHistory(name string) (*[]dbCommon.HistoryRow, error) {
+	var result []dbCommon.HistoryRow
+	qp := &queryParams{}
+	q := fmt.Sprintf("SELECT name,date,old_state,new_state,actor,reason FROM %s ORDER BY name, date ;", y.HistoryTableName)
+	if len(name) > 0 {
+		q = fmt.Sprintf("SELECT name,date,old_state,new_state,actor,reason FROM %s WHERE name = %s ORDER BY date ;",
+			y.HistoryTableName, qp.add("name", name))
+	}
+	err := y.query(q, qp, func(res *table.Result) {
+		result = nil
+		for res.NextSet() {
+			for res.NextRow() {
+				var tmpRow dbCommon.HistoryRow
+				res.SeekItem("name")
+				tmpRow.Name = string(res.OString())
+				res.NextItem()
+				tmpRow.Date = timestampTime(res.OTimestamp())
+				res.NextItem()
+				tmpRow.OldState = string(res.OString())
+				res.NextItem()
+				tmpRow.NewState = string(res.OString())
+				res.NextItem()
+				tmpRow.Actor = string(res.OString())
+				res.NextItem()
+				tmpRow.Reason = string(res.OString())
+				result = append(result, tmpRow)
+			}
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &result, nil
 }
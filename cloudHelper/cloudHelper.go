@@ -5,8 +5,19 @@ import (
 	"ya-ansible-inventory/cloud"
 	"ya-ansible-inventory/cloud/aws"
 	"ya-ansible-inventory/cloud/yandex"
+	"ya-ansible-inventory/config"
 )
 
+// Requirements returns settings of cloud type, unknown type is reported by MakeCloud
+func Requirements(t string) []config.Requirement {
+	switch t {
+	case "yandex", "yacloud":
+		return yandex.Requirements()
+	default:
+		return nil
+	}
+}
+
 func MakeCloud(t string) (cloud.Cloud, error) {
 	switch t {
 	case "yandex", "yacloud":
@@ -5,34 +5,112 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 	cl "ya-ansible-inventory/cloud"
+	cloudAWS "ya-ansible-inventory/cloud/aws"
 	"ya-ansible-inventory/cloudDB"
+	"ya-ansible-inventory/cloudDB/dbCommon"
 	ch "ya-ansible-inventory/cloudHelper"
 	"ya-ansible-inventory/common"
+	"ya-ansible-inventory/config"
+	"ya-ansible-inventory/inventory"
 )
 
 var (
 	instancePerPage int64 = 256
 	args            argsT
 	errNat          = errors.New("Nat IP not found")
+	// source is inventory source file of --source flag
+	source *inventory.Source
+	// keyedGroups are groups of --keyed-groups flag
+	keyedGroups []inventory.KeyedGroup
+	// envFlags are flags with ENV defaults, defaults are read again after config file is applied
+	envFlags = map[string]string{
+		"db-owner":          "DB_OWNER",
+		"aws-profile":       "AWS_PROFILE",
+		"aws-regions":       "AWS_REGIONS",
+		"aws-assume-roles":  "AWS_ASSUME_ROLES",
+		"aws-external-id":   "AWS_EXTERNAL_ID",
+		"aws-session-name":  "AWS_ROLE_SESSION_NAME",
+		"keyed-groups":      "KEYED_GROUPS",
+		"keyed-separator":   "KEYED_SEPARATOR",
+		"hostname-fallback": "HOSTNAME_FALLBACK",
+		"duplicate-hosts":   "DUPLICATE_HOSTS",
+		"lowercase-groups":  "LOWERCASE_GROUPS",
+		"sanitize-groups":   "SANITIZE_GROUPS",
+		"network-groups":    "NETWORK_GROUPS",
+		"host-network":      "HOST_NETWORK_FACTS",
+		"serve":             "SERVE_ADDR",
+		"serve-refresh":     "SERVE_REFRESH",
+		"prom-sd":           "PROM_SD_FILE",
+		"prom-ports":        "PROM_PORTS",
+		"prom-address":      "PROM_ADDRESS",
+		"source":            "INVENTORY_SOURCE",
+		"profile":           "INVENTORY_PROFILE",
+	}
 )
 
 type argsT struct {
-	List        bool
-	Host        string
-	Ssh         bool
-	SshUser     string
-	SshPort     int
-	SshNatGroup string
-	DbList      bool
-	DbCreate    string
-	DbSet       string
+	List           bool
+	Host           string
+	Ssh            bool
+	SshUser        string
+	SshPort        int
+	SshNatGroup    string
+	DbList         bool
+	DbCreate       string
+	DbSet          string
+	DbLock         string
+	DbUnlock       string
+	DbHistory      string
+	DbDelete       string
+	DbArchive      string
+	DbExport       string
+	DbImport       string
+	DbImportMode   string
+	DbMigrate      bool
+	DbRepair       bool
+	DbFormat       string
+	DbState        string
+	DbNamePrefix   string
+	DbHaMode       string
+	DbCreated      [2]string
+	DbUpdated      [2]string
+	DbOwner        string
+	DbReason       string
+	DbLockTTL      time.Duration
+	Force          bool
+	AwsProfile     string
+	AwsRegions     string
+	AwsRoles       string
+	AwsExtId       string
+	AwsSession     string
+	Config         string
+	Profile        string
+	Source         string
+	KeyedGroups    string
+	KeyedSep       string
+	HostFallback   string
+	DupHosts       string
+	LowerGroups    bool
+	SanitizeGroups bool
+	NetGroups      string
+	HostNetwork    bool
+	Serve          string
+	ServeRefresh   time.Duration
+	Diff           string
+	DiffFormat     string
+	PromSD         string
+	PromPorts      string
+	PromAddress    string
 }
 
 type sshConf struct {
@@ -41,15 +119,6 @@ type sshConf struct {
 	GWPort int
 }
 
-type ansibleGroup struct {
-	Hosts    []string               `json:"hosts,omitempty"`
-	Vars     map[string]interface{} `json:"vars,omitempty"`
-	HostVars map[string]ansibleVars `json:"hostvars,omitempty"`
-}
-
-type ansibleInventory map[string]ansibleGroup
-type ansibleVars map[string]string
-
 func main() {
 	flag.BoolVar(&args.List, "list", false, "List inventory")
 	flag.StringVar(&args.Host, "host", "", "Get Host vars")
@@ -57,44 +126,191 @@ func main() {
 	flag.BoolVar(&args.DbList, "db-list", false, "DB List workspaces")
 	flag.StringVar(&args.DbCreate, "db-create", "", "DB Create WorkSpace")
 	flag.StringVar(&args.DbSet, "db-set", "", "DB Set State")
+	flag.StringVar(&args.DbLock, "db-lock", "", "DB Lock WorkSpace")
+	flag.StringVar(&args.DbUnlock, "db-unlock", "", "DB Unlock WorkSpace")
+	flag.StringVar(&args.DbHistory, "db-history", "", "DB Show WorkSpace history")
+	flag.StringVar(&args.DbDelete, "db-delete", "", "DB Delete destroyed WorkSpace")
+	flag.StringVar(&args.DbArchive, "db-archive", "", "DB Move destroyed WorkSpace to archive")
+	flag.StringVar(&args.DbFormat, "db-format", dbCommon.FormatJSON, "DB List output format: table, json, jsonl, csv")
+	flag.StringVar(&args.DbState, "db-state", "", "DB List workspaces in state")
+	flag.StringVar(&args.DbNamePrefix, "db-name-prefix", "", "DB List workspaces with name prefix")
+	flag.StringVar(&args.DbHaMode, "db-ha-mode", "", "DB List workspaces with ha_mode true or false")
+	flag.StringVar(&args.DbCreated[0], "db-created-after", "", "DB List workspaces created since date, RFC3339 or YYYY-MM-DD")
+	flag.StringVar(&args.DbCreated[1], "db-created-before", "", "DB List workspaces created until date inclusive, RFC3339 or YYYY-MM-DD for the whole day")
+	flag.StringVar(&args.DbUpdated[0], "db-updated-after", "", "DB List workspaces updated since date, RFC3339 or YYYY-MM-DD")
+	flag.StringVar(&args.DbUpdated[1], "db-updated-before", "", "DB List workspaces updated until date inclusive, RFC3339 or YYYY-MM-DD for the whole day")
+	flag.StringVar(&args.DbExport, "db-export", "", "DB Export workspaces with history as JSON lines to file, - for stdout")
+	flag.StringVar(&args.DbImport, "db-import", "", "DB Import workspaces with history from JSON lines file, - for stdin")
+	flag.StringVar(&args.DbImportMode, "db-import-mode", cloudDB.ImportFail, "Import conflict strategy: skip, overwrite, fail")
+	flag.BoolVar(&args.DbMigrate, "db-migrate", false, "DB Upgrade registry schema")
+	flag.BoolVar(&args.DbRepair, "db-repair-dates", false, "DB Rewrite timestamps of older releases in canonical form")
+	flag.StringVar(&args.DbOwner, "db-owner", defaultOwner(), "Set lock owner and history actor, env DB_OWNER or user@host by default")
+	flag.StringVar(&args.DbReason, "db-reason", "", "Set reason for history record")
+	flag.DurationVar(&args.DbLockTTL, "db-lock-ttl", 30*time.Minute, "Set lock lease duration")
+	flag.BoolVar(&args.Force, "force", false, "Force DB operation, skip state and lock checks")
 	flag.StringVar(&args.SshUser, "ssh-user", "cloud-user", "Set user for ssh.conf")
 	flag.StringVar(&args.SshNatGroup, "ssh-nat-group", "nat", "Set nat group for ssh.conf")
 	flag.IntVar(&args.SshPort, "ssh-port", 22, "Set GW port for ssh.conf")
+	flag.StringVar(&args.AwsProfile, "aws-profile", os.Getenv("AWS_PROFILE"), "Set AWS shared config profile, env AWS_PROFILE by default")
+	flag.StringVar(&args.AwsRegions, "aws-regions", os.Getenv("AWS_REGIONS"), "Set comma separated AWS regions of EC2 discovery, env AWS_REGIONS by default")
+	flag.StringVar(&args.AwsRoles, "aws-assume-roles", os.Getenv("AWS_ASSUME_ROLES"), "Set comma separated chain of AWS role ARNs to assume, env AWS_ASSUME_ROLES by default")
+	flag.StringVar(&args.AwsExtId, "aws-external-id", os.Getenv("AWS_EXTERNAL_ID"), "Set external id of the last assumed AWS role, env AWS_EXTERNAL_ID by default")
+	flag.StringVar(&args.AwsSession, "aws-session-name", os.Getenv("AWS_ROLE_SESSION_NAME"), "Set session name of assumed AWS roles, env AWS_ROLE_SESSION_NAME by default")
+	flag.StringVar(&args.Config, "config", "", "Set config file, "+config.FileName+" or $XDG_CONFIG_HOME/ya-inventory/config.yaml by default")
+	flag.StringVar(&args.Profile, "profile", os.Getenv("INVENTORY_PROFILE"), "Set config file profile, env INVENTORY_PROFILE by default")
+	flag.StringVar(&args.Source, "source", os.Getenv("INVENTORY_SOURCE"), "Set inventory source YAML file with plugin: "+inventory.PluginName+", env INVENTORY_SOURCE by default")
+	flag.StringVar(&args.KeyedGroups, "keyed-groups", os.Getenv("KEYED_GROUPS"), "Set comma separated group keys as expression[=prefix], e.g. labels.env,zone,instance_type=type, env KEYED_GROUPS by default")
+	flag.StringVar(&args.KeyedSep, "keyed-separator", os.Getenv("KEYED_SEPARATOR"), "Set separator of keyed group prefix and value, _ by default, env KEYED_SEPARATOR by default")
+	flag.StringVar(&args.HostFallback, "hostname-fallback", envDefault("HOSTNAME_FALLBACK", "id"), "Set comma separated host name fallbacks of hosts without name: id, private_dns or template like web-{{ id }}, env HOSTNAME_FALLBACK by default")
+	flag.StringVar(&args.DupHosts, "duplicate-hosts", envDefault("DUPLICATE_HOSTS", inventory.DuplicateSuffix), "Set policy of duplicate host names: suffix with id, error, skip, env DUPLICATE_HOSTS by default")
+	flag.BoolVar(&args.SanitizeGroups, "sanitize-groups", os.Getenv("SANITIZE_GROUPS") == "true", "Replace characters of group names other than letters, digits and underscore with underscore, env SANITIZE_GROUPS by default")
+	flag.BoolVar(&args.LowerGroups, "lowercase-groups", os.Getenv("LOWERCASE_GROUPS") == "true", "Lowercase group names, env LOWERCASE_GROUPS by default")
+	flag.StringVar(&args.NetGroups, "network-groups", envDefault("NETWORK_GROUPS", "nat"), "Set comma separated groups to add subnet and VPC vars of workspace, env NETWORK_GROUPS by default")
+	flag.BoolVar(&args.HostNetwork, "host-network", os.Getenv("HOST_NETWORK_FACTS") == "true", "Add subnet and VPC vars of own subnets to every host, env HOST_NETWORK_FACTS by default")
+	flag.StringVar(&args.Serve, "serve", os.Getenv("SERVE_ADDR"), "Serve inventory, ssh config and workspaces over HTTP on address like :8080, env SERVE_ADDR by default")
+	flag.DurationVar(&args.ServeRefresh, "serve-refresh", envDuration("SERVE_REFRESH", 5*time.Minute), "Set inventory refresh interval of --serve, env SERVE_REFRESH by default")
+	flag.StringVar(&args.Diff, "diff", "", "Compare inventory with --list JSON snapshot file, exit code 2 on differences")
+	flag.StringVar(&args.DiffFormat, "diff-format", "text", "Set --diff output format: text, json")
+	flag.StringVar(&args.PromSD, "prom-sd", os.Getenv("PROM_SD_FILE"), "Write Prometheus file_sd JSON file, rewritten on every refresh of --serve, env PROM_SD_FILE by default")
+	flag.StringVar(&args.PromPorts, "prom-ports", envDefault("PROM_PORTS", "9100"), "Set comma separated target ports as group=port, port without group is used for hosts out of listed groups, env PROM_PORTS by default")
+	flag.StringVar(&args.PromAddress, "prom-address", envDefault("PROM_ADDRESS", "ansible_host"), "Set hostvar of target address, e.g. ansible_host or public_address, env PROM_ADDRESS by default")
 	flag.Parse()
-	envLabels := []string{"CLOUD_TYPE"}
-	envs, err := common.CheckEnvs(envLabels)
+	err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyedGroups, err = inventory.ParseKeyedGroups(args.KeyedGroups, args.KeyedSep)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = inventory.CheckDuplicates(args.DupHosts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(args.Source) > 0 {
+		source, err = inventory.LoadSource(args.Source)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = config.Check(requirements())
 	if err != nil {
-		log.Fatal("You must set this ENVs: %s", strings.Join(envLabels, ", "))
+		log.Fatal(err)
 	}
+	awsOpts := cloudAWS.Options{Profile: args.AwsProfile, Regions: cloudAWS.SplitList(args.AwsRegions)}
+	awsOpts.SetRoles(cloudAWS.SplitList(args.AwsRoles), args.AwsExtId, args.AwsSession)
+	cloudAWS.SetOptions(awsOpts)
 	if args.List {
-		ai, err := newAnsibleInventory()
+		ai, err := buildInventory()
+		if err != nil {
+			log.Fatal(err)
+		}
+		printJSON(ai)
+	} else if len(args.Diff) > 0 {
+		equal, err := diffSnapshot(args.Diff, args.DiffFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !equal {
+			os.Exit(2)
+		}
+	} else if len(args.Serve) > 0 {
+		err = serve()
 		if err != nil {
 			log.Fatal(err)
 		}
-		ai.print()
-	} else if args.DbList || len(args.DbCreate) > 0 || len(args.DbSet) > 0 {
+	} else if len(args.PromSD) > 0 {
+		ai, hosts, err := buildInventoryHosts()
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = writePromSD(args.PromSD, ai, hosts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if dbMode() {
 		//dbList()
-		cloud, err := ch.MakeCloud(envs["CLOUD_TYPE"])
+		backend, err := cloudDB.BackendFromEnv()
 		if err != nil {
 			log.Fatal(err)
 		}
-		db, err := cloudDB.MakeCloudDB(cloud, envs["CLOUD_TYPE"])
+		db, err := cloudDB.MakeCloudDB(backend)
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer db.Close()
-		if args.DbList {
-			err = db.List()
+		if !args.DbMigrate {
+			err = cloudDB.CheckSchema(db)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		dbOpts := dbCommon.Opts{Force: args.Force, Owner: args.DbOwner, Reason: args.DbReason}
+		if args.DbMigrate {
+			applied, err := db.Migrate()
+			for _, m := range applied {
+				fmt.Printf("Applied migration %d: %s\n", m.Version, m.Name)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if args.DbList {
+			f, err := dbFilter()
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = db.List(f, args.DbFormat)
 			if err != nil {
 				log.Fatal(err)
 			}
 		} else if len(args.DbCreate) > 0 {
-			err = db.Create(args.DbCreate)
+			err = db.Create(args.DbCreate, dbOpts)
 			if err != nil {
 				log.Fatal(err)
 			}
 		} else if len(args.DbSet) > 0 {
-			err = db.SetState(args.DbSet)
+			err = db.SetState(args.DbSet, dbOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if len(args.DbLock) > 0 {
+			err = db.Lock(args.DbLock, args.DbLockTTL, dbOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if len(args.DbUnlock) > 0 {
+			err = db.Unlock(args.DbUnlock, dbOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if len(args.DbHistory) > 0 {
+			err = db.History(args.DbHistory)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if len(args.DbDelete) > 0 {
+			err = db.Delete(args.DbDelete, dbOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if len(args.DbArchive) > 0 {
+			err = db.Archive(args.DbArchive, dbOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if args.DbRepair {
+			n, err := db.RepairDates()
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Repaired %d rows\n", n)
+		} else if len(args.DbExport) > 0 {
+			err = dbExport(db, args.DbExport)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if len(args.DbImport) > 0 {
+			err = dbImport(db, args.DbImport, args.DbImportMode)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -115,45 +331,213 @@ func main() {
 	}
 }
 
-func (ai *ansibleInventory) print() {
-	prepareBytes, err := json.MarshalIndent(ai, "", "  ")
+// inventoryMode reports whether operation builds inventory of cloud hosts
+func inventoryMode() bool {
+	return args.List || args.Ssh || len(args.Serve) > 0 || len(args.Diff) > 0 || len(args.PromSD) > 0
+}
+
+// dbMode reports whether any DB operation is requested
+func dbMode() bool {
+	return args.DbList || len(args.DbCreate) > 0 || len(args.DbSet) > 0 || len(args.DbLock) > 0 || len(args.DbUnlock) > 0 ||
+		len(args.DbHistory) > 0 || len(args.DbDelete) > 0 || len(args.DbArchive) > 0 || len(args.DbExport) > 0 || len(args.DbImport) > 0 || args.DbMigrate || args.DbRepair
+}
+
+// loadConfig applies config file settings to unset ENVs, precedence is flag > ENV > file
+func loadConfig() error {
+	path, err := config.Find(args.Config)
+	if err != nil || len(path) < 1 {
+		return err
+	}
+	settings, err := config.Load(path, args.Profile)
+	if err != nil {
+		return err
+	}
+	err = config.Apply(settings)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, env := range envFlags {
+		if v := os.Getenv(env); !set[name] && len(v) > 0 {
+			err = flag.Set(name, v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// requirements returns settings of requested operation
+func requirements() []config.Requirement {
+	if source != nil && (inventoryMode() || len(args.Host) > 0) {
+		t := sourceCloudType()
+		if len(t) < 1 {
+			return []config.Requirement{{"CLOUD_TYPE"}}
+		}
+		return ch.Requirements(t)
+	}
+	if inventoryMode() {
+		reqs := []config.Requirement{{"WORKSPACE"}, {"CLOUD_TYPE"}}
+		return append(reqs, ch.Requirements(os.Getenv("CLOUD_TYPE"))...)
+	}
+	if dbMode() {
+		backend, err := cloudDB.BackendFromEnv()
+		if err != nil {
+			return []config.Requirement{{"STATE_BACKEND", "CLOUD_TYPE"}}
+		}
+		return cloudDB.Requirements(backend)
+	}
+	return nil
+}
+
+// naming returns host naming of flags: host name with fallbacks and duplicates policy
+func naming() inventory.Naming {
+	hostnames := []string{"name"}
+	for _, f := range strings.Split(args.HostFallback, ",") {
+		if f = strings.TrimSpace(f); len(f) > 0 {
+			hostnames = append(hostnames, f)
+		}
+	}
+	return inventory.Naming{Hostnames: hostnames, Duplicates: args.DupHosts}
+}
+
+// networkFacts returns network facts of flags
+func networkFacts() inventory.NetworkFacts {
+	var groups []string
+	for _, g := range strings.Split(args.NetGroups, ",") {
+		if g = strings.TrimSpace(g); len(g) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return inventory.NetworkFacts{Groups: groups, Hosts: args.HostNetwork}
+}
+
+// envDuration returns ENV duration, def if ENV is not set or is not a duration
+func envDuration(env string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(env)); err == nil {
+		return d
+	}
+	return def
+}
+
+// envDefault returns ENV value, def if ENV is not set
+func envDefault(env, def string) string {
+	if v := os.Getenv(env); len(v) > 0 {
+		return v
+	}
+	return def
+}
+
+func defaultOwner() string {
+	if owner := os.Getenv("DB_OWNER"); len(owner) > 0 {
+		return owner
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s", os.Getenv("USER"), host)
+}
+
+func printJSON(v interface{}) {
+	prepareBytes, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Print(string(prepareBytes))
 }
 
-func newAnsibleInventory() (ansibleInventory, error) {
+// buildInventory makes inventory of --source file or of WORKSPACE labeled hosts
+func buildInventory() (inventory.Inventory, error) {
+	inv, _, err := buildInventoryHosts()
+	return inv, err
+}
+
+// buildInventoryHosts makes inventory and returns cloud hosts keyed by inventory name
+func buildInventoryHosts() (inventory.Inventory, map[string]cl.Host, error) {
+	if source != nil {
+		return sourceInventory()
+	}
+	return newAnsibleInventory()
+}
+
+// sourceInventory makes inventory of hosts selected by source filters
+func sourceInventory() (inventory.Inventory, map[string]cl.Host, error) {
+	cloud, err := ch.MakeCloud(sourceCloudType())
+	if err != nil {
+		return nil, nil, err
+	}
+	instances, err := cloud.GetInstances(source.Filter())
+	if err != nil {
+		return nil, nil, err
+	}
+	inv, err := source.Build(instances)
+	if err != nil {
+		return nil, nil, err
+	}
+	hosts, err := source.HostsByName(instances)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = source.ApplyNetwork(inv, cloud, hosts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inv, hosts, nil
+}
+
+// sourceCloudType returns cloud_type of source, CLOUD_TYPE is used if it is not set
+func sourceCloudType() string {
+	if len(source.CloudType) > 0 {
+		return source.CloudType
+	}
+	return os.Getenv("CLOUD_TYPE")
+}
+
+func newAnsibleInventory() (inventory.Inventory, map[string]cl.Host, error) {
 	//TODO Check ENV vars on begining
 	envLabels := []string{"WORKSPACE", "CLOUD_TYPE"}
 	envs, err := common.CheckEnvs(envLabels)
 	if err != nil {
-		return nil, fmt.Errorf("You must set this ENVs: %s", strings.Join(envLabels, ", "))
+		return nil, nil, fmt.Errorf("You must set this ENVs: %s", strings.Join(envLabels, ", "))
 	}
 
 	cloud, err := ch.MakeCloud(envs["CLOUD_TYPE"])
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	wsFilter := &cl.LabelFilter{
 		LabelEqual: map[string]string{"workspace": envs["WORKSPACE"]},
 	}
 	instances, err := cloud.GetInstances(wsFilter)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	ansibleInventory := ansibleInventory{}
-	ansibleMeta := map[string]ansibleVars{}
+	var facts []inventory.Vars
 	for _, i := range instances {
+		facts = append(facts, inventory.HostFacts(i))
+	}
+	names, err := naming().Names(instances, facts)
+	if err != nil {
+		return nil, nil, err
+	}
+	ansibleInventory := inventory.Inventory{}
+	ansibleMeta := map[string]inventory.Vars{}
+	for n, i := range instances {
 		iLabels := i.GetLabels()
 		groupAllItem := ansibleInventory["all"]
-		iName := i.GetName()
+		iName := names[n]
+		if len(iName) < 1 {
+			continue
+		}
 		groupAllItem.Hosts = append(groupAllItem.Hosts, iName)
 		sort.Strings(groupAllItem.Hosts)
 		ansibleInventory["all"] = groupAllItem
 		iIfases := i.GetInterfaces()
+		ansibleMeta[iName] = inventory.Vars{}
 		if len(iIfases.Private) > 0 {
-			ansibleMeta[iName] = ansibleVars{"ansible_host": iIfases.Private[0]}
+			ansibleMeta[iName]["ansible_host"] = iIfases.Private[0]
 		}
 		if len(iIfases.Public) > 0 && len(iIfases.Public[0]) > 0 {
 			ansibleMeta[iName]["public_address"] = iIfases.Public[0]
@@ -169,6 +553,7 @@ func newAnsibleInventory() (ansibleInventory, error) {
 		groupItem.Vars = common.MergeKeys(groupItem.Vars, common.RenameKeys("tf_", iLabels))
 		ansibleInventory[group] = groupItem
 	}
+	ansibleInventory.NormalizeGroups(args.SanitizeGroups, args.LowerGroups)
 
 	for k, v := range ansibleInventory {
 		if k == "all" || k == "_meta" {
@@ -179,25 +564,47 @@ func newAnsibleInventory() (ansibleInventory, error) {
 		}
 	}
 
-	metaGroup := ansibleGroup{}
-	metaGroup.HostVars = ansibleMeta
-	ansibleInventory["_meta"] = metaGroup
-	// Add subnet vars to nat group
-	if natGroup, ok := ansibleInventory["nat"]; ok {
-		subnets, err := cloud.GetSubnets(wsFilter)
-		if err != nil {
-			return ansibleInventory, nil
+	// Keyed groups are added after group ids, ids are numbered within groups of group label only
+	for n, name := range names {
+		if len(name) < 1 {
+			continue
 		}
-		var cidrBlocks []string
-		for _, s := range subnets {
-			cidrBlocks = append(cidrBlocks, s.GetCidrs()...)
+		for _, kg := range keyedGroups {
+			groups, err := kg.GroupNames(facts[n])
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			for _, g := range groups {
+				ansibleInventory.AddHost(g, name)
+			}
 		}
-		natGroup.Vars["tf_subnets"] = cidrBlocks
 	}
-	return ansibleInventory, nil
+	ansibleInventory.NormalizeGroups(args.SanitizeGroups, args.LowerGroups)
+
+	metaGroup := inventory.Group{}
+	metaGroup.HostVars = ansibleMeta
+	ansibleInventory["_meta"] = metaGroup
+	hosts := inventory.HostsByName(instances, names)
+	err = networkFacts().Apply(ansibleInventory, cloud, wsFilter, hosts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ansibleInventory, hosts, nil
 }
 
 func ansibleHost(h string) error {
+	if source != nil {
+		ai, err := buildInventory()
+		if err != nil {
+			return err
+		}
+		vars := ai.HostVars(h)
+		if vars == nil {
+			vars = inventory.Vars{}
+		}
+		printJSON(vars)
+		return nil
+	}
 	// Print default answer with meta
 	dump := `{"_meta": {"hostvars": {} } }`
 	var obj map[string]interface{}
@@ -211,11 +618,18 @@ func ansibleHost(h string) error {
 }
 
 func getSshConf() error {
-	ai, err := newAnsibleInventory()
+	ai, err := buildInventory()
 	if err != nil {
 		return err
 	}
-	natList, ok := ai[args.SshNatGroup]
+	return writeSshConf(os.Stdout, ai)
+}
+
+// writeSshConf writes ssh config with first host of nat group as gateway
+func writeSshConf(w io.Writer, ai inventory.Inventory) error {
+	// Nat group may be renamed by --sanitize-groups and --lowercase-groups
+	natGroup, _ := ai.LookupGroup(args.SshNatGroup)
+	natList, ok := ai[natGroup]
 	if !ok {
 		return errNat
 	}
@@ -223,7 +637,7 @@ func getSshConf() error {
 		return errNat
 	}
 	natHost := natList.Hosts[0]
-	natHostIp, ok := ai["_meta"].HostVars[natHost]["public_address"]
+	natHostIp, ok := ai.HostVars(natHost)["public_address"].(string)
 	if !ok {
 		return errNat
 	}
@@ -237,9 +651,133 @@ func getSshConf() error {
 		return err
 
 	}
-	err = t.Execute(os.Stdout, conf)
+	err = t.Execute(w, conf)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// writePromSD writes Prometheus file_sd targets of inventory, file is replaced atomically
+func writePromSD(path string, ai inventory.Inventory, hosts map[string]cl.Host) error {
+	ports, defPort, err := inventory.ParsePorts(args.PromPorts)
+	if err != nil {
+		return err
+	}
+	sd := inventory.PromSD{
+		Address:     args.PromAddress,
+		Ports:       ports,
+		DefaultPort: defPort,
+		Labels:      map[string]string{"workspace": os.Getenv("WORKSPACE")},
+	}
+	b, err := json.MarshalIndent(sd.Targets(ai, hosts), "", "  ")
+	if err != nil {
+		return err
+	}
+	return common.WriteFileAtomic(path, b, 0644)
+}
+
+// diffSnapshot prints difference of inventory from snapshot, reports whether they are equal
+func diffSnapshot(path, format string) (bool, error) {
+	if format != "text" && format != "json" {
+		return false, fmt.Errorf("Unknown diff format: %s", format)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	snapshot := inventory.Inventory{}
+	err = json.Unmarshal(b, &snapshot)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	ai, err := buildInventory()
+	if err != nil {
+		return false, err
+	}
+	d, err := inventory.Compare(snapshot, ai)
+	if err != nil {
+		return false, err
+	}
+	if format == "json" {
+		printJSON(d)
+		fmt.Println()
+	} else {
+		err = d.WriteText(os.Stdout)
+	}
+	return d.Empty(), err
+}
+
+// dbFilter returns workspace filter of --db-list flags
+func dbFilter() (dbCommon.Filter, error) {
+	return workspaceFilter(func(key string) string {
+		return flag.Lookup("db-" + key).Value.String()
+	}, "--db-")
+}
+
+// workspaceFilter returns workspace filter of state, name-prefix, ha-mode and date range values,
+// prefix is added to key names in errors
+func workspaceFilter(get func(key string) string, prefix string) (dbCommon.Filter, error) {
+	f := dbCommon.Filter{State: get("state"), NamePrefix: get("name-prefix")}
+	if len(f.State) > 0 && !dbCommon.IsState(f.State) {
+		return f, fmt.Errorf("Unknown workspace state: %s", f.State)
+	}
+	if haModeValue := get("ha-mode"); len(haModeValue) > 0 {
+		haMode, err := strconv.ParseBool(haModeValue)
+		if err != nil {
+			return f, fmt.Errorf("Bad %sha-mode: %w", prefix, err)
+		}
+		f.HaMode = &haMode
+	}
+	for _, d := range []struct {
+		key   string
+		dst   **time.Time
+		parse func(string) (time.Time, error)
+	}{
+		{"created-after", &f.CreatedAfter, dbCommon.ParseTime},
+		{"created-before", &f.CreatedBefore, dbCommon.ParseUpperBound},
+		{"updated-after", &f.UpdatedAfter, dbCommon.ParseTime},
+		{"updated-before", &f.UpdatedBefore, dbCommon.ParseUpperBound},
+	} {
+		value := get(d.key)
+		if len(value) < 1 {
+			continue
+		}
+		t, err := d.parse(value)
+		if err != nil {
+			return f, fmt.Errorf("Bad %s%s: %w", prefix, d.key, err)
+		}
+		*d.dst = &t
+	}
+	return f, nil
+}
+
+// dbExport writes registry dump to file, stdout is used for "-"
+func dbExport(db cloudDB.CloudDB, path string) error {
+	if path == "-" {
+		return cloudDB.Export(db, os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = cloudDB.Export(db, f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dbImport reads registry dump from file, stdin is used for "-"
+func dbImport(db cloudDB.CloudDB, path, mode string) error {
+	if path == "-" {
+		return cloudDB.Import(db, os.Stdin, mode)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return cloudDB.Import(db, f, mode)
+}
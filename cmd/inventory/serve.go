@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"ya-ansible-inventory/cloudDB"
+	"ya-ansible-inventory/cloudDB/dbCommon"
+	"ya-ansible-inventory/common"
+	"ya-ansible-inventory/inventory"
+)
+
+var (
+	errNotReady  = errors.New("Inventory is not built yet")
+	errNoBackend = errors.New("State backend is not configured")
+)
+
+// inventoryCache keeps inventory built in background, last good inventory is served on refresh errors
+type inventoryCache struct {
+	mu      sync.RWMutex
+	inv     inventory.Inventory
+	updated time.Time
+	err     error
+}
+
+// refresh builds inventory, --prom-sd file is rewritten of every new inventory
+func (c *inventoryCache) refresh() {
+	inv, hosts, err := buildInventoryHosts()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	if err != nil {
+		log.Printf("Inventory refresh: %s", err)
+		return
+	}
+	c.inv = inv
+	c.updated = time.Now()
+	if len(args.PromSD) > 0 {
+		c.err = writePromSD(args.PromSD, inv, hosts)
+		if c.err != nil {
+			log.Printf("Prometheus file_sd: %s", c.err)
+		}
+	}
+}
+
+func (c *inventoryCache) get() (inventory.Inventory, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.inv == nil {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, errNotReady
+	}
+	return c.inv, nil
+}
+
+// server serves inventory of cache and workspaces of state backend, db is nil without backend
+type server struct {
+	cache   *inventoryCache
+	db      cloudDB.CloudDB
+	refresh time.Duration
+}
+
+// serve runs HTTP server until SIGINT or SIGTERM, inventory is refreshed every --serve-refresh
+func serve() error {
+	if args.ServeRefresh <= 0 {
+		return fmt.Errorf("Bad --serve-refresh: %s", args.ServeRefresh)
+	}
+	s := &server{cache: &inventoryCache{}, refresh: args.ServeRefresh}
+	// Workspaces are optional, inventory is served without state backend
+	if backend, err := cloudDB.BackendFromEnv(); err == nil {
+		db, err := cloudDB.MakeCloudDB(backend)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		s.db = db
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s.cache.refresh()
+	go func() {
+		t := time.NewTicker(s.refresh)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.cache.refresh()
+			}
+		}
+	}()
+	srv := &http.Server{Addr: args.Serve, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Printf("Serving inventory on %s", args.Serve)
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/inventory", s.inventory)
+	mux.HandleFunc("/hosts/", s.host)
+	mux.HandleFunc("/ssh-config", s.sshConfig)
+	mux.HandleFunc("/workspaces", s.workspaces)
+	mux.HandleFunc("/health", s.health)
+	return mux
+}
+
+// inventory serves --list JSON, query filters: group (any of), name-prefix and var.<name>=<value>
+func (s *server) inventory(w http.ResponseWriter, r *http.Request) {
+	ai, err := s.cache.get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	if len(q) > 0 {
+		ai = ai.Select(hostFilter(ai, q))
+	}
+	writeJSON(w, r, ai)
+}
+
+// hostFilter returns host selector of query filters
+func hostFilter(ai inventory.Inventory, q map[string][]string) func(string) bool {
+	var groupHosts []string
+	groups, byGroup := q["group"]
+	for _, g := range groups {
+		name, _ := ai.LookupGroup(g)
+		groupHosts = append(groupHosts, ai.GroupHosts(name)...)
+	}
+	prefix := strings.Join(q["name-prefix"], "")
+	return func(h string) bool {
+		if byGroup && !common.Contains(groupHosts, h) {
+			return false
+		}
+		if !strings.HasPrefix(h, prefix) {
+			return false
+		}
+		vars := ai.HostVars(h)
+		for k, v := range q {
+			name := strings.TrimPrefix(k, "var.")
+			if name == k {
+				continue
+			}
+			if len(v) < 1 || fmt.Sprint(vars[name]) != v[0] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (s *server) host(w http.ResponseWriter, r *http.Request) {
+	ai, err := s.cache.get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/hosts/")
+	vars := ai.HostVars(name)
+	if vars == nil {
+		if !common.Contains(ai[inventory.GroupAll].Hosts, name) {
+			http.Error(w, fmt.Sprintf("Host not found: %s", name), http.StatusNotFound)
+			return
+		}
+		vars = inventory.Vars{}
+	}
+	writeJSON(w, r, vars)
+}
+
+func (s *server) sshConfig(w http.ResponseWriter, r *http.Request) {
+	ai, err := s.cache.get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	var buf bytes.Buffer
+	err = writeSshConf(&buf, ai)
+	if errors.Is(err, errNat) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeBody(w, r, "text/plain; charset=utf-8", buf.Bytes())
+}
+
+// workspaces serves --db-list of state backend, query filters are --db-list flags without db- prefix
+// and format
+func (s *server) workspaces(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		http.Error(w, errNoBackend.Error(), http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	f, err := workspaceFilter(q.Get, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, err := s.db.Find(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	format := q.Get("format")
+	var buf bytes.Buffer
+	err = dbCommon.WriteRows(&buf, rows, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentType := "application/json"
+	switch format {
+	case dbCommon.FormatJSONL:
+		contentType = "application/x-ndjson"
+	case dbCommon.FormatCSV:
+		contentType = "text/csv; charset=utf-8"
+	case dbCommon.FormatTable:
+		contentType = "text/plain; charset=utf-8"
+	}
+	writeBody(w, r, contentType, buf.Bytes())
+}
+
+// health is ok while last good inventory is younger than three refresh intervals
+func (s *server) health(w http.ResponseWriter, r *http.Request) {
+	s.cache.mu.RLock()
+	status := map[string]interface{}{"status": "ok"}
+	code := http.StatusOK
+	if s.cache.inv == nil || time.Since(s.cache.updated) > 3*s.refresh {
+		status["status"] = "fail"
+		code = http.StatusServiceUnavailable
+	}
+	if s.cache.inv != nil {
+		status["updated"] = s.cache.updated.UTC().Format(time.RFC3339)
+		status["hosts"] = len(s.cache.inv[inventory.GroupAll].Hosts)
+	}
+	if s.cache.err != nil {
+		status["error"] = s.cache.err.Error()
+	}
+	s.cache.mu.RUnlock()
+	b, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeBody(w, r, "application/json", b)
+}
+
+// writeBody writes body with ETag of its content, 304 is returned for matching If-None-Match
+func writeBody(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	for _, m := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if m = strings.TrimSpace(m); m == etag || m == "*" || m == "W/"+etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
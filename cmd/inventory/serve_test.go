@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+	"ya-ansible-inventory/inventory"
+)
+
+func testServer(updated time.Time) *server {
+	inv := inventory.Inventory{}
+	for _, h := range []string{"web-1", "web-2", "db-1"} {
+		inv.AddHost(inventory.GroupAll, h)
+	}
+	inv.AddHost("web_servers", "web-1")
+	inv.AddHost("web_servers", "web-2")
+	inv.AddHost("db", "db-1")
+	inv.SetHostVars("web-1", inventory.Vars{"env": "prod"})
+	inv.SetHostVars("web-2", inventory.Vars{"env": "dev"})
+	inv.SetHostVars("db-1", inventory.Vars{"env": "prod"})
+	return &server{cache: &inventoryCache{inv: inv, updated: updated}, refresh: time.Minute}
+}
+
+func get(t *testing.T, h http.Handler, url string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestServeInventory(t *testing.T) {
+	h := testServer(time.Now()).handler()
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"db-1", "web-1", "web-2"}},
+		{"?group=web_servers", []string{"web-1", "web-2"}},
+		{"?group=Web-Servers", []string{"web-1", "web-2"}},
+		{"?group=db&group=nosuch", []string{"db-1"}},
+		{"?name-prefix=web-2", []string{"web-2"}},
+		{"?var.env=prod", []string{"db-1", "web-1"}},
+		{"?group=web_servers&var.env=prod", []string{"web-1"}},
+		{"?var.env=test", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := get(t, h, "/inventory"+tt.query, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var inv inventory.Inventory
+			err := json.Unmarshal(w.Body.Bytes(), &inv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := inv[inventory.GroupAll].Hosts; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hosts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	s := &server{cache: &inventoryCache{}, refresh: time.Minute}
+	if w := get(t, s.handler(), "/inventory", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status before first refresh = %d", w.Code)
+	}
+}
+
+func TestServeETag(t *testing.T) {
+	h := testServer(time.Now()).handler()
+	w := get(t, h, "/inventory", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || len(etag) < 1 {
+		t.Fatalf("status = %d, ETag = %q", w.Code, etag)
+	}
+	for _, m := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w = get(t, h, "/inventory", map[string]string{"If-None-Match": m})
+		if w.Code != http.StatusNotModified || w.Body.Len() > 0 {
+			t.Errorf("If-None-Match %s: status = %d, body %d bytes", m, w.Code, w.Body.Len())
+		}
+	}
+	w = get(t, h, "/inventory", map[string]string{"If-None-Match": `"other"`})
+	if w.Code != http.StatusOK {
+		t.Errorf("mismatched If-None-Match: status = %d", w.Code)
+	}
+	// Filtered inventory has its own tag
+	if w = get(t, h, "/inventory?group=db", nil); w.Header().Get("ETag") == etag {
+		t.Error("ETag of filtered inventory is not changed")
+	}
+}
+
+func TestServeHealth(t *testing.T) {
+	tests := []struct {
+		name   string
+		server *server
+		code   int
+		status string
+	}{
+		{"fresh", testServer(time.Now()), http.StatusOK, "ok"},
+		{"stale", testServer(time.Now().Add(-4 * time.Minute)), http.StatusServiceUnavailable, "fail"},
+		{"not built", &server{cache: &inventoryCache{}, refresh: time.Minute}, http.StatusServiceUnavailable, "fail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(t, tt.server.handler(), "/health", nil)
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+			var status map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status["status"] != tt.status {
+				t.Errorf("health = %v", status)
+			}
+		})
+	}
+}
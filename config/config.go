@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"ya-ansible-inventory/common"
+)
+
+const (
+	// FileName is config file searched in current directory
+	FileName = "ya-inventory.yaml"
+	// DefaultProfile is used if profile is not selected by flag, env or default_profile of file
+	DefaultProfile = "default"
+)
+
+var (
+	errNoConfigFile = errors.New("Config file not found")
+	// Known are settings of config file, names are lower case ENV names
+	Known = []string{
+		"CLOUD_TYPE", "WORKSPACE", "STATE_BACKEND", "DB_OWNER", "KEYED_GROUPS", "KEYED_SEPARATOR",
+		"INVENTORY_SOURCE", "INVENTORY_PROFILE",
+		"HOSTNAME_FALLBACK", "DUPLICATE_HOSTS", "LOWERCASE_GROUPS", "SANITIZE_GROUPS",
+		"NETWORK_GROUPS", "HOST_NETWORK_FACTS", "SERVE_ADDR", "SERVE_REFRESH",
+		"PROM_SD_FILE", "PROM_PORTS", "PROM_ADDRESS",
+		"FOLDER_ID", "YC_TOKEN", "YC_SERVICE_ACCOUNT_KEY_FILE", "YC_METADATA_CREDENTIALS", "YC_DB",
+		"YDB_ENDPOINT", "YDB_DATABASE", "YDB_DIAL_TIMEOUT", "YDB_REQUEST_TIMEOUT", "YDB_OPERATION_TIMEOUT", "YDB_MAX_RETRIES",
+		"AWS_PROFILE", "AWS_REGION", "AWS_REGIONS", "AWS_ASSUME_ROLES", "AWS_EXTERNAL_ID", "AWS_ROLE_SESSION_NAME",
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_TABLE", "AWS_HISTORY_TABLE", "AWS_ARCHIVE_TABLE", "AWS_NETID_TABLE", "AWS_META_TABLE",
+		"DDB_REGION", "DDB_BILLING_MODE", "DDB_READ_CAPACITY", "DDB_WRITE_CAPACITY",
+		"LOCAL_DB", "NET_ID_MIN", "NET_ID_MAX",
+	}
+)
+
+// File is YAML config, settings are shared by all profiles and overridden by selected profile
+type File struct {
+	DefaultProfile string                            `yaml:"default_profile"`
+	Settings       map[string]interface{}            `yaml:"settings"`
+	Profiles       map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// Find returns path of config file: path if not empty, FileName in current directory
+// or ya-inventory/config.yaml in $XDG_CONFIG_HOME (~/.config by default). Empty path is returned if no file found
+func Find(path string) (string, error) {
+	if len(path) > 0 {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("%w: %s", errNoConfigFile, path)
+		}
+		return path, nil
+	}
+	candidates := []string{FileName}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if len(configHome) < 1 {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if len(configHome) > 0 {
+		candidates = append(candidates, filepath.Join(configHome, "ya-inventory", "config.yaml"))
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", nil
+}
+
+// Load reads settings of profile from config file, ENV references in values are expanded.
+// Profile of default_profile or DefaultProfile is used for empty profile
+func Load(path, profile string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	err = yaml.UnmarshalStrict(b, &f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// Typos are reported for every profile, not only for selected one
+	var unknown []string
+	for _, p := range append([]map[string]interface{}{f.Settings}, profileList(f.Profiles)...) {
+		for k := range p {
+			if !isKnown(strings.ToUpper(k)) && !common.Contains(unknown, k) {
+				unknown = append(unknown, k)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("%s: unknown settings: %s", path, strings.Join(unknown, ", "))
+	}
+	raw := map[string]interface{}{}
+	for k, v := range f.Settings {
+		raw[k] = v
+	}
+	explicit := len(profile) > 0
+	if !explicit {
+		profile = f.DefaultProfile
+		explicit = len(profile) > 0
+	}
+	if !explicit {
+		profile = DefaultProfile
+	}
+	p, ok := f.Profiles[profile]
+	if !ok && explicit {
+		return nil, fmt.Errorf("%s: profile %q not found", path, profile)
+	}
+	for k, v := range p {
+		raw[k] = v
+	}
+	settings := map[string]string{}
+	for k, v := range raw {
+		s, err := settingString(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, k, err)
+		}
+		settings[strings.ToUpper(k)] = Expand(s)
+	}
+	return settings, nil
+}
+
+// Apply sets ENVs of settings which are not set, so ENV takes precedence over config file,
+// empty ENV is not set as for requirements check
+func Apply(settings map[string]string) error {
+	for k, v := range settings {
+		if isSet(k) {
+			continue
+		}
+		err := os.Setenv(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSet reports whether ENV is set and not empty
+func isSet(env string) bool {
+	return len(os.Getenv(env)) > 0
+}
+
+// Expand replaces ${VAR} and $VAR with ENV values, ${VAR:-default} gives default for empty ENV
+func Expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		if i := strings.Index(name, ":-"); i > 0 {
+			if v := os.Getenv(name[:i]); len(v) > 0 {
+				return v
+			}
+			return name[i+2:]
+		}
+		return os.Getenv(name)
+	})
+}
+
+// settingString converts scalar or list value, list is joined with commas
+func settingString(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(t), nil
+	case []interface{}:
+		var items []string
+		for _, i := range t {
+			s, err := settingString(i)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+func profileList(profiles map[string]map[string]interface{}) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, p := range profiles {
+		result = append(result, p)
+	}
+	return result
+}
+
+func isKnown(name string) bool {
+	return common.Contains(Known, name)
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Requirement is satisfied if any of its ENVs is set
+type Requirement []string
+
+func (r Requirement) satisfied() bool {
+	for _, e := range r {
+		if isSet(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	return strings.Join(r, " or ")
+}
+
+// Check returns error with every missing setting
+func Check(reqs []Requirement) error {
+	var missing []string
+	seen := map[string]bool{}
+	for _, r := range reqs {
+		s := r.String()
+		if r.satisfied() || seen[s] {
+			continue
+		}
+		seen[s] = true
+		missing = append(missing, s)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("You must set this ENVs or config settings: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"ya-ansible-inventory/cloud"
+)
+
+// HostFacts are variables of host available to expressions and written to hostvars
+func HostFacts(h cloud.Host) Vars {
+	labels := map[string]interface{}{}
+	for k, v := range h.GetLabels() {
+		labels[k] = v
+	}
+	ifaces := h.GetInterfaces()
+	facts := Vars{
+		"name":          h.GetName(),
+		"id":            h.GetId(),
+		"labels":        labels,
+		"zone":          h.GetZone(),
+		"instance_type": h.GetInstanceType(),
+		"private_dns":   h.GetPrivateDNS(),
+		"private_ips":   stringList(ifaces.Private),
+		"public_ips":    stringList(ifaces.Public),
+		"subnet_ids":    stringList(ifaces.Subnets),
+	}
+	if len(ifaces.Private) > 0 {
+		facts["private_ip"] = ifaces.Private[0]
+		facts["ansible_host"] = ifaces.Private[0]
+	}
+	if len(ifaces.Public) > 0 && len(ifaces.Public[0]) > 0 {
+		facts["public_ip"] = ifaces.Public[0]
+		facts["public_address"] = ifaces.Public[0]
+	}
+	return facts
+}
+
+// Filter returns cloud filter of source filters
+func (s *Source) Filter() cloud.Filter {
+	return &cloud.LabelFilter{LabelEqual: s.Filters.Labels}
+}
+
+// Build makes inventory of hosts with compose, groups and keyed_groups of source
+func (s *Source) Build(hosts []cloud.Host) (Inventory, error) {
+	inv := Inventory{GroupAll: Group{}, GroupMeta: Group{HostVars: map[string]Vars{}}}
+	var facts []Vars
+	for _, h := range hosts {
+		facts = append(facts, HostFacts(h))
+	}
+	names, err := s.naming().Names(hosts, facts)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if len(name) < 1 {
+			continue
+		}
+		err = s.addHost(inv, name, facts[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	inv.NormalizeGroups(s.SanitizeGroups, s.LowercaseGroups)
+	return inv, nil
+}
+
+// ApplyNetwork adds network facts of source to inventory built of hosts
+func (s *Source) ApplyNetwork(inv Inventory, c cloud.Cloud, hosts map[string]cloud.Host) error {
+	return s.NetworkFacts.Apply(inv, c, s.Filter(), hosts)
+}
+
+// HostsByName maps inventory names of source to hosts
+func (s *Source) HostsByName(hosts []cloud.Host) (map[string]cloud.Host, error) {
+	var facts []Vars
+	for _, h := range hosts {
+		facts = append(facts, HostFacts(h))
+	}
+	names, err := s.naming().Names(hosts, facts)
+	if err != nil {
+		return nil, err
+	}
+	return HostsByName(hosts, names), nil
+}
+
+func (s *Source) naming() Naming {
+	return Naming{Hostnames: s.Hostnames, Duplicates: s.Duplicates, Strict: s.Strict}
+}
+
+func (s *Source) addHost(inv Inventory, name string, vars Vars) error {
+	inv.AddHost(GroupAll, name)
+	for _, kv := range s.Compose {
+		v, err := Eval(kv.Value.(string), vars)
+		if s.skip(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		vars[kv.Key.(string)] = v
+	}
+	inv.SetHostVars(name, vars)
+	for _, kv := range s.Groups {
+		v, err := Eval(kv.Value.(string), vars)
+		if s.skip(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if Truthy(v) {
+			inv.AddHost(kv.Key.(string), name)
+		}
+	}
+	for _, kg := range s.KeyedGroups {
+		groups, err := kg.GroupNames(vars)
+		if s.skip(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			inv.AddHost(g, name)
+			if len(kg.ParentGroup) > 0 {
+				inv.AddChild(kg.ParentGroup, g)
+			}
+		}
+	}
+	return nil
+}
+
+// skip reports whether error of expression is ignored, syntax errors are reported even if not strict
+func (s *Source) skip(err error) bool {
+	return err != nil && !s.Strict && !isSyntaxError(err)
+}
+
+// GroupNames returns sanitized names of groups of host
+func (kg KeyedGroup) GroupNames(vars Vars) ([]string, error) {
+	v, err := Eval(kg.Key, vars)
+	if err == errUndefined || (err == nil && !Truthy(v)) {
+		if len(kg.DefaultValue) < 1 {
+			return nil, nil
+		}
+		v, err = kg.DefaultValue, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			values = append(values, k+kg.Separator+ToString(val))
+		}
+		sort.Strings(values)
+	case []interface{}, []string:
+		for _, i := range toList(t) {
+			values = append(values, ToString(i))
+		}
+	default:
+		values = []string{ToString(v)}
+	}
+	var names []string
+	for _, val := range values {
+		if len(val) < 1 {
+			continue
+		}
+		names = append(names, kg.groupName(val))
+	}
+	return names, nil
+}
+
+func (kg KeyedGroup) groupName(value string) string {
+	if len(kg.Prefix) < 1 && kg.LeadingSeparator != nil && !*kg.LeadingSeparator {
+		return SanitizeGroup(value)
+	}
+	return SanitizeGroup(kg.Prefix + kg.Separator + value)
+}
+
+// SanitizeGroup makes valid Ansible group name: characters other than letters, digits
+// and underscore are replaced with underscore, name starting with digit is prefixed with underscore
+func SanitizeGroup(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// ParseKeyedGroups parses comma separated list of key expressions with optional prefix as key=prefix,
+// prefix is the last part of key by default: labels.env gives groups env_<value>
+func ParseKeyedGroups(spec, separator string) ([]KeyedGroup, error) {
+	var result []KeyedGroup
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) < 1 {
+			continue
+		}
+		kg := KeyedGroup{Key: item, Separator: separator}
+		prefix := ""
+		if i := strings.LastIndex(item, "="); i > 0 && item[i-1] != '=' && item[i-1] != '!' {
+			kg.Key, prefix = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		tokens, err := tokenize(kg.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(prefix) < 1 {
+			// Last name of key: labels.env and labels['env'] give env
+			for _, t := range tokens {
+				if t.kind == 'i' || t.kind == 's' {
+					prefix = t.value
+				}
+			}
+		}
+		kg.Prefix = prefix
+		if len(kg.Separator) < 1 {
+			kg.Separator = "_"
+		}
+		result = append(result, kg)
+	}
+	return result, nil
+}
+
+func stringList(a []string) []interface{} {
+	result := []interface{}{}
+	for _, s := range a {
+		if len(s) > 0 {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,280 @@
+package inventory
+
+import (
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"ya-ansible-inventory/cloud"
+)
+
+// fakeHost is in-memory cloud host
+type fakeHost struct {
+	name, id, zone, instanceType, privateDNS string
+	labels                                   map[string]string
+	ifaces                                   cloud.Iface
+}
+
+func (h fakeHost) GetName() string              { return h.name }
+func (h fakeHost) GetId() string                { return h.id }
+func (h fakeHost) GetLabels() map[string]string { return h.labels }
+func (h fakeHost) GetInterfaces() cloud.Iface   { return h.ifaces }
+func (h fakeHost) GetZone() string              { return h.zone }
+func (h fakeHost) GetInstanceType() string      { return h.instanceType }
+func (h fakeHost) GetPrivateDNS() string        { return h.privateDNS }
+
+func TestParseKeyedGroups(t *testing.T) {
+	tests := []struct {
+		spec      string
+		separator string
+		want      []KeyedGroup
+		err       bool
+	}{
+		{"", "", nil, false},
+		{"labels.env", "", []KeyedGroup{{Key: "labels.env", Prefix: "env", Separator: "_"}}, false},
+		{"labels['role']=r, zone", "-", []KeyedGroup{
+			{Key: "labels['role']", Prefix: "r", Separator: "-"},
+			{Key: "zone", Prefix: "zone", Separator: "-"},
+		}, false},
+		{"labels.env == 'prod'", "", []KeyedGroup{{Key: "labels.env == 'prod'", Prefix: "prod", Separator: "_"}}, false},
+		{"labels['env", "", nil, true},
+		{"labels.env=e,zone $", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseKeyedGroups(tt.spec, tt.separator)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("= %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyedGroupNames(t *testing.T) {
+	no := false
+	tests := []struct {
+		name string
+		kg   KeyedGroup
+		want []string
+		err  bool
+	}{
+		{"string", KeyedGroup{Key: "labels.env", Prefix: "env", Separator: "_"}, []string{"env_prod"}, false},
+		{"separator", KeyedGroup{Key: "labels.env", Prefix: "env", Separator: "-"}, []string{"env_prod"}, false},
+		{"no prefix", KeyedGroup{Key: "zone", Separator: "_"}, []string{"_ru_central1_a"}, false},
+		{"no leading separator", KeyedGroup{Key: "zone", Separator: "_", LeadingSeparator: &no}, []string{"ru_central1_a"}, false},
+		{"list", KeyedGroup{Key: "ips", Prefix: "ip", Separator: "_"}, []string{"ip_10_0_0_1", "ip_10_0_0_2"}, false},
+		{"map", KeyedGroup{Key: "labels", Prefix: "tag", Separator: "_"}, []string{"tag_env_prod", "tag_role__web_"}, false},
+		{"number", KeyedGroup{Key: "cores", Prefix: "", Separator: "", LeadingSeparator: &no}, []string{"_4"}, false},
+		{"undefined", KeyedGroup{Key: "labels.missing", Prefix: "x", Separator: "_"}, nil, false},
+		{"empty", KeyedGroup{Key: "empty", Prefix: "x", Separator: "_"}, nil, false},
+		{"default value", KeyedGroup{Key: "labels.missing", Prefix: "x", Separator: "_", DefaultValue: "none"}, []string{"x_none"}, false},
+		{"bad key", KeyedGroup{Key: "labels.", Prefix: "x", Separator: "_"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.kg.GroupNames(exprVars())
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("= %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeGroup(t *testing.T) {
+	tests := map[string]string{
+		"web":       "web",
+		"web-prod":  "web_prod",
+		"a.b c":     "a_b_c",
+		"1st":       "_1st",
+		"Mixed_Ok9": "Mixed_Ok9",
+		"":          "",
+	}
+	for in, want := range tests {
+		if got := SanitizeGroup(in); got != want {
+			t.Errorf("SanitizeGroup(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func buildSource() *Source {
+	return &Source{
+		Hostnames: []string{"name"},
+		Compose: yaml.MapSlice{
+			{Key: "ansible_user", Value: "'ubuntu'"},
+			{Key: "fqdn", Value: "name ~ '.example.com'"},
+			{Key: "gpu", Value: "labels.gpu"},
+		},
+		Groups: yaml.MapSlice{
+			{Key: "webservers", Value: "labels.role == 'web'"},
+			{Key: "gpus", Value: "labels.gpu == 'yes'"},
+		},
+		KeyedGroups: []KeyedGroup{
+			{Key: "labels.env", Prefix: "env", Separator: "_", ParentGroup: "envs"},
+			{Key: "zone", Separator: "_"},
+		},
+	}
+}
+
+func buildHosts() []cloud.Host {
+	return []cloud.Host{
+		fakeHost{
+			name: "web-1", id: "i-1", zone: "zone-a", instanceType: "standard-v3", privateDNS: "web-1.internal",
+			labels: map[string]string{"env": "prod", "role": "web"},
+			ifaces: cloud.Iface{Private: []string{"10.0.0.1"}, Public: []string{"1.2.3.4"}, Subnets: []string{"s-1"}},
+		},
+		fakeHost{
+			name: "db-1", id: "i-2", zone: "zone-b",
+			labels: map[string]string{"env": "dev"},
+			ifaces: cloud.Iface{Private: []string{"10.0.1.1"}, Public: []string{""}},
+		},
+	}
+}
+
+func TestSourceBuild(t *testing.T) {
+	inv, err := buildSource().Build(buildHosts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Inventory{
+		GroupAll:     Group{Hosts: []string{"db-1", "web-1"}},
+		"webservers": Group{Hosts: []string{"web-1"}},
+		"env_prod":   Group{Hosts: []string{"web-1"}},
+		"env_dev":    Group{Hosts: []string{"db-1"}},
+		"envs":       Group{Children: []string{"env_dev", "env_prod"}},
+		"_zone_a":    Group{Hosts: []string{"web-1"}},
+		"_zone_b":    Group{Hosts: []string{"db-1"}},
+		GroupMeta: Group{HostVars: map[string]Vars{
+			"web-1": {
+				"name":           "web-1",
+				"id":             "i-1",
+				"labels":         map[string]interface{}{"env": "prod", "role": "web"},
+				"zone":           "zone-a",
+				"instance_type":  "standard-v3",
+				"private_dns":    "web-1.internal",
+				"private_ips":    []interface{}{"10.0.0.1"},
+				"public_ips":     []interface{}{"1.2.3.4"},
+				"subnet_ids":     []interface{}{"s-1"},
+				"private_ip":     "10.0.0.1",
+				"ansible_host":   "10.0.0.1",
+				"public_ip":      "1.2.3.4",
+				"public_address": "1.2.3.4",
+				"ansible_user":   "ubuntu",
+				"fqdn":           "web-1.example.com",
+			},
+			"db-1": {
+				"name":          "db-1",
+				"id":            "i-2",
+				"labels":        map[string]interface{}{"env": "dev"},
+				"zone":          "zone-b",
+				"instance_type": "",
+				"private_dns":   "",
+				"private_ips":   []interface{}{"10.0.1.1"},
+				"public_ips":    []interface{}{},
+				"subnet_ids":    []interface{}{},
+				"private_ip":    "10.0.1.1",
+				"ansible_host":  "10.0.1.1",
+				"ansible_user":  "ubuntu",
+				"fqdn":          "db-1.example.com",
+			},
+		}},
+	}
+	if !reflect.DeepEqual(inv, want) {
+		t.Errorf("inventory:\n%#v\nwant:\n%#v", inv, want)
+	}
+}
+
+func TestSourceBuildStrict(t *testing.T) {
+	s := buildSource()
+	s.Strict = true
+	_, err := s.Build(buildHosts())
+	if err == nil {
+		t.Error("undefined variable of compose is not reported in strict mode")
+	}
+	s = buildSource()
+	s.Groups = append(s.Groups, yaml.MapItem{Key: "bad", Value: "labels.role =="})
+	_, err = s.Build(buildHosts())
+	if !isSyntaxError(err) {
+		t.Errorf("syntax error is not reported: %v", err)
+	}
+}
+
+func TestSourceHostnames(t *testing.T) {
+	s := buildSource()
+	s.Hostnames = []string{"labels.host", "labels.role", "id"}
+	inv, err := s.Build(buildHosts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inv[GroupAll].Hosts; !reflect.DeepEqual(got, []string{"i-2", "web"}) {
+		t.Errorf("hosts = %v", got)
+	}
+}
+
+func TestSourceBuildGroupNames(t *testing.T) {
+	s := buildSource()
+	s.Groups = yaml.MapSlice{{Key: "Web-Servers", Value: "labels.role == 'web'"}}
+	s.KeyedGroups = nil
+	inv, err := s.Build(buildHosts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := inv["Web-Servers"]; !ok {
+		t.Error("group name is changed without sanitize_groups")
+	}
+	s.SanitizeGroups, s.LowercaseGroups = true, true
+	inv, err = s.Build(buildHosts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inv["web_servers"].Hosts; !reflect.DeepEqual(got, []string{"web-1"}) {
+		t.Errorf("web_servers hosts = %v", got)
+	}
+}
+
+func TestLoadSource(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  bool
+	}{
+		{"minimal", "plugin: ya_cloud\n", false},
+		{"collection plugin", "plugin: community.ya_cloud\nkeyed_groups:\n  - key: zone\n", false},
+		{"wrong plugin", "plugin: aws_ec2\n", true},
+		{"unknown field", "plugin: ya_cloud\nnosuch: 1\n", true},
+		{"compose not string", "plugin: ya_cloud\ncompose:\n  a: [1]\n", true},
+		{"keyed group without key", "plugin: ya_cloud\nkeyed_groups:\n  - prefix: x\n", true},
+		{"bad duplicates", "plugin: ya_cloud\nduplicates: rename\n", true},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+".yml")
+			err := ioutil.WriteFile(path, []byte(tt.yaml), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := LoadSource(path)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(s.Hostnames, []string{"name"}) {
+				t.Errorf("default hostnames = %v", s.Hostnames)
+			}
+			for _, kg := range s.KeyedGroups {
+				if kg.Separator != "_" {
+					t.Errorf("default separator = %q", kg.Separator)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Diff is difference of two inventories, hostvars are compared for hosts present in both
+type Diff struct {
+	Added    []string            `json:"added_hosts"`
+	Removed  []string            `json:"removed_hosts"`
+	Groups   map[string]Members  `json:"groups"`
+	HostVars map[string]VarsDiff `json:"hostvars"`
+}
+
+// Members are hosts and children added to and removed from group with changes of group vars
+type Members struct {
+	Added           []string  `json:"added,omitempty"`
+	Removed         []string  `json:"removed,omitempty"`
+	AddedChildren   []string  `json:"added_children,omitempty"`
+	RemovedChildren []string  `json:"removed_children,omitempty"`
+	Vars            *VarsDiff `json:"vars,omitempty"`
+}
+
+// VarsDiff are vars of host, changed vars keep old and new value
+type VarsDiff struct {
+	Added   Vars              `json:"added,omitempty"`
+	Removed Vars              `json:"removed,omitempty"`
+	Changed map[string]Change `json:"changed,omitempty"`
+}
+
+// Change is old and new value of var
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Compare returns difference of cur from old, values are compared in JSON form
+// so inventory loaded from snapshot equals inventory it was written of
+func Compare(old, cur Inventory) (Diff, error) {
+	d := Diff{Added: []string{}, Removed: []string{}, Groups: map[string]Members{}, HostVars: map[string]VarsDiff{}}
+	old, err := jsonForm(old)
+	if err != nil {
+		return d, err
+	}
+	cur, err = jsonForm(cur)
+	if err != nil {
+		return d, err
+	}
+	oldHosts, curHosts := old.hosts(), cur.hosts()
+	d.Added, d.Removed = difference(oldHosts, curHosts)
+	for _, name := range groupNames(old, cur) {
+		var m Members
+		// Hosts of all group are reported as added and removed hosts
+		if name != GroupAll {
+			m.Added, m.Removed = difference(old[name].Hosts, cur[name].Hosts)
+		}
+		m.AddedChildren, m.RemovedChildren = difference(old[name].Children, cur[name].Children)
+		if vd := compareVars(old[name].Vars, cur[name].Vars); !vd.empty() {
+			m.Vars = &vd
+		}
+		if len(m.Added)+len(m.Removed)+len(m.AddedChildren)+len(m.RemovedChildren) > 0 || m.Vars != nil {
+			d.Groups[name] = m
+		}
+	}
+	for _, h := range curHosts {
+		if !contains(oldHosts, h) {
+			continue
+		}
+		if vd := compareVars(old.HostVars(h), cur.HostVars(h)); !vd.empty() {
+			d.HostVars[h] = vd
+		}
+	}
+	return d, nil
+}
+
+// Empty reports whether inventories are equal
+func (d Diff) Empty() bool {
+	return len(d.Added) < 1 && len(d.Removed) < 1 && len(d.Groups) < 1 && len(d.HostVars) < 1
+}
+
+// WriteText writes diff in human readable form: + added, - removed, ~ changed
+func (d Diff) WriteText(w io.Writer) error {
+	var lines []string
+	for _, h := range d.Added {
+		lines = append(lines, fmt.Sprintf("+ host %s", h))
+	}
+	for _, h := range d.Removed {
+		lines = append(lines, fmt.Sprintf("- host %s", h))
+	}
+	for _, g := range mapKeys(d.Groups) {
+		m := d.Groups[g]
+		for _, h := range m.Added {
+			lines = append(lines, fmt.Sprintf("+ group %s: %s", g, h))
+		}
+		for _, h := range m.Removed {
+			lines = append(lines, fmt.Sprintf("- group %s: %s", g, h))
+		}
+		for _, c := range m.AddedChildren {
+			lines = append(lines, fmt.Sprintf("+ group %s child: %s", g, c))
+		}
+		for _, c := range m.RemovedChildren {
+			lines = append(lines, fmt.Sprintf("- group %s child: %s", g, c))
+		}
+		if m.Vars != nil {
+			lines = append(lines, m.Vars.lines("groupvar", g)...)
+		}
+	}
+	for _, h := range mapKeys(d.HostVars) {
+		lines = append(lines, d.HostVars[h].lines("hostvar", h)...)
+	}
+	for _, l := range lines {
+		_, err := fmt.Fprintln(w, l)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hosts returns hosts of all groups and hostvars, sorted
+func (inv Inventory) hosts() []string {
+	var hosts []string
+	for name, g := range inv {
+		for _, h := range g.Hosts {
+			if !contains(hosts, h) {
+				hosts = append(hosts, h)
+			}
+		}
+		if name != GroupMeta {
+			continue
+		}
+		for h := range g.HostVars {
+			if !contains(hosts, h) {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (vd VarsDiff) empty() bool {
+	return len(vd.Added)+len(vd.Removed)+len(vd.Changed) < 1
+}
+
+// lines returns text lines of vars changes of host or group
+func (vd VarsDiff) lines(kind, owner string) []string {
+	var lines []string
+	for _, k := range mapKeys(vd.Added) {
+		lines = append(lines, fmt.Sprintf("+ %s %s.%s = %s", kind, owner, k, jsonString(vd.Added[k])))
+	}
+	for _, k := range mapKeys(vd.Removed) {
+		lines = append(lines, fmt.Sprintf("- %s %s.%s = %s", kind, owner, k, jsonString(vd.Removed[k])))
+	}
+	for _, k := range mapKeys(vd.Changed) {
+		c := vd.Changed[k]
+		lines = append(lines, fmt.Sprintf("~ %s %s.%s: %s -> %s", kind, owner, k, jsonString(c.Old), jsonString(c.New)))
+	}
+	return lines
+}
+
+func compareVars(old, cur map[string]interface{}) VarsDiff {
+	vd := VarsDiff{Added: Vars{}, Removed: Vars{}, Changed: map[string]Change{}}
+	for k, v := range cur {
+		o, ok := old[k]
+		if !ok {
+			vd.Added[k] = v
+		} else if !reflect.DeepEqual(o, v) {
+			vd.Changed[k] = Change{Old: o, New: v}
+		}
+	}
+	for k, v := range old {
+		if _, ok := cur[k]; !ok {
+			vd.Removed[k] = v
+		}
+	}
+	return vd
+}
+
+// difference returns items of cur missing in old and items of old missing in cur
+func difference(old, cur []string) ([]string, []string) {
+	added, removed := []string{}, []string{}
+	for _, s := range cur {
+		if !contains(old, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if !contains(cur, s) {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func groupNames(invs ...Inventory) []string {
+	var names []string
+	for _, inv := range invs {
+		for name := range inv {
+			if name != GroupMeta && !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mapKeys returns sorted keys of map with string keys
+func mapKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonForm(inv Inventory) (Inventory, error) {
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return nil, err
+	}
+	res := Inventory{}
+	err = json.Unmarshal(b, &res)
+	return res, err
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,73 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func diffInventory() Inventory {
+	inv := Inventory{}
+	inv.AddHost(GroupAll, "a")
+	inv.AddHost(GroupAll, "b")
+	inv.AddHost("web", "a")
+	inv.AddChild("prod", "web")
+	inv["nat"] = Group{Vars: map[string]interface{}{"tf_subnets": []string{"10.0.0.0/24"}}}
+	inv.SetHostVars("a", Vars{"ansible_host": "10.0.0.1", "port": 22})
+	inv.SetHostVars("b", Vars{})
+	return inv
+}
+
+func TestCompareSnapshot(t *testing.T) {
+	b, err := json.Marshal(diffInventory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := Inventory{}
+	err = json.Unmarshal(b, &snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Compare(snapshot, diffInventory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() {
+		t.Errorf("inventory differs from its snapshot: %+v", d)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cur := diffInventory()
+	cur.AddHost(GroupAll, "c")
+	cur.AddHost("db", "a")
+	cur.AddChild("prod", "db")
+	cur["nat"] = Group{Vars: map[string]interface{}{"tf_subnets": []string{"10.0.1.0/24"}}}
+	cur.SetHostVars("a", Vars{"ansible_host": "10.0.0.2", "port": 22, "zone": "a"})
+	d, err := Compare(diffInventory(), cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Empty() {
+		t.Fatal("diff is empty")
+	}
+	var buf bytes.Buffer
+	err = d.WriteText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `+ host c
++ group db: a
+~ groupvar nat.tf_subnets: ["10.0.0.0/24"] -> ["10.0.1.0/24"]
++ group prod child: db
++ hostvar a.zone = "a"
+~ hostvar a.ansible_host: "10.0.0.1" -> "10.0.0.2"
+`
+	if buf.String() != want {
+		t.Errorf("text diff:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if got := d.Groups["prod"].AddedChildren; !reflect.DeepEqual(got, []string{"db"}) {
+		t.Errorf("prod added children = %v", got)
+	}
+}
@@ -0,0 +1,556 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expressions are subset of Jinja2 used by Ansible constructed inventories: variables with
+// attribute and index access, string, number, boolean and list literals, operators
+// or, and, not, ==, !=, <, <=, >, >=, in, not in, ~ and +, tests "is defined" and "is not defined",
+// filters default, lower, upper, trim, replace and join
+
+var (
+	errUndefined = errors.New("Undefined variable")
+	errSyntax    = errors.New("Expression syntax error")
+)
+
+type token struct {
+	kind  byte // 'i' identifier, 's' string, 'n' number, 'o' operator, 0 end
+	value string
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("%w: unterminated string in %q", errSyntax, s)
+			}
+			tokens = append(tokens, token{'s', b.String()})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && unicode.IsDigit(rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{'n', s[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{'i', s[i:j]})
+			i = j
+		default:
+			if i+1 < len(s) && strings.Contains("== != <= >=", s[i:i+2]) {
+				tokens = append(tokens, token{'o', s[i : i+2]})
+				i += 2
+				continue
+			}
+			if !strings.ContainsRune("()[].,|~+<>", c) {
+				return nil, fmt.Errorf("%w: unexpected %q in %q", errSyntax, c, s)
+			}
+			tokens = append(tokens, token{'o', string(c)})
+			i++
+		}
+	}
+	return append(tokens, token{}), nil
+}
+
+// parser evaluates expression while parsing, evaluation errors are carried with values
+// so that default filter and "is defined" test can handle undefined variables
+type parser struct {
+	tokens []token
+	pos    int
+	vars   map[string]interface{}
+	err    error
+}
+
+// Eval evaluates expression over vars, expression may be wrapped in {{ }}
+func Eval(expr string, vars map[string]interface{}) (interface{}, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "{{") && strings.HasSuffix(expr, "}}") {
+		expr = expr[2 : len(expr)-2]
+	}
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, vars: vars}
+	v, err := p.or()
+	if p.err == nil && p.peek().kind != 0 {
+		p.fail("unexpected %q", p.peek().value)
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("%w: %s in %q", errSyntax, p.err, expr)
+	}
+	return v, err
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(kind byte, value string) bool {
+	t := p.peek()
+	if t.kind == kind && t.value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(value string) {
+	if !p.accept('o', value) {
+		p.fail("expected %q", value)
+	}
+}
+
+func (p *parser) fail(format string, a ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, a...)
+	}
+	// Stop parsing
+	p.pos = len(p.tokens) - 1
+}
+
+func (p *parser) or() (interface{}, error) {
+	v, err := p.and()
+	for p.accept('i', "or") {
+		r, rErr := p.and()
+		if err == nil && Truthy(v) {
+			continue
+		}
+		v, err = r, rErr
+	}
+	return v, err
+}
+
+func (p *parser) and() (interface{}, error) {
+	v, err := p.not()
+	for p.accept('i', "and") {
+		r, rErr := p.not()
+		if err == nil && !Truthy(v) {
+			continue
+		}
+		v, err = r, rErr
+	}
+	return v, err
+}
+
+func (p *parser) not() (interface{}, error) {
+	if p.accept('i', "not") {
+		v, err := p.not()
+		return !Truthy(v), err
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (interface{}, error) {
+	l, err := p.concat()
+	t := p.peek()
+	op := ""
+	switch {
+	case t.kind == 'o' && strings.Contains("== != < <= > >=", t.value):
+		op = t.value
+	case t.kind == 'i' && t.value == "in":
+		op = "in"
+	case t.kind == 'i' && t.value == "not" && p.tokens[p.pos+1].kind == 'i' && p.tokens[p.pos+1].value == "in":
+		op = "not in"
+		p.next()
+	default:
+		return l, err
+	}
+	p.next()
+	r, rErr := p.concat()
+	if err == nil {
+		err = rErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		return contains(r, l), nil
+	case "not in":
+		return !contains(r, l), nil
+	}
+	c, ok := compareValues(l, r)
+	if !ok {
+		return nil, fmt.Errorf("Can not compare %v and %v", l, r)
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func (p *parser) concat() (interface{}, error) {
+	v, err := p.postfix()
+	for {
+		var op string
+		switch {
+		case p.accept('o', "~"):
+			op = "~"
+		case p.accept('o', "+"):
+			op = "+"
+		default:
+			return v, err
+		}
+		r, rErr := p.postfix()
+		if err == nil {
+			err = rErr
+		}
+		if err != nil {
+			continue
+		}
+		ln, lok := v.(int64)
+		rn, rok := r.(int64)
+		if op == "+" && lok && rok {
+			v = ln + rn
+			continue
+		}
+		v = ToString(v) + ToString(r)
+	}
+}
+
+func (p *parser) postfix() (interface{}, error) {
+	v, err := p.primary()
+	for {
+		switch {
+		case p.accept('o', "."):
+			t := p.next()
+			if t.kind != 'i' {
+				p.fail("expected attribute name")
+				return nil, err
+			}
+			if err == nil {
+				v, err = attr(v, t.value)
+			}
+		case p.accept('o', "["):
+			k, kErr := p.or()
+			p.expect("]")
+			if err == nil {
+				err = kErr
+			}
+			if err == nil {
+				v, err = attr(v, k)
+			}
+		case p.accept('o', "|"):
+			t := p.next()
+			if t.kind != 'i' {
+				p.fail("expected filter name")
+				return nil, err
+			}
+			var args []interface{}
+			var argErr error
+			if p.accept('o', "(") {
+				args, argErr = p.list(")")
+			}
+			if argErr != nil {
+				return nil, argErr
+			}
+			v, err = p.filter(t.value, v, err, args)
+		case p.accept('i', "is"):
+			negate := p.accept('i', "not")
+			if !p.accept('i', "defined") {
+				p.fail("only defined test is supported")
+				return nil, err
+			}
+			defined := err != errUndefined
+			if defined && err != nil {
+				return nil, err
+			}
+			v, err = defined != negate, nil
+		default:
+			return v, err
+		}
+	}
+}
+
+func (p *parser) list(end string) ([]interface{}, error) {
+	var items []interface{}
+	var err error
+	if p.accept('o', end) {
+		return items, nil
+	}
+	for {
+		v, vErr := p.or()
+		if err == nil {
+			err = vErr
+		}
+		items = append(items, v)
+		if !p.accept('o', ",") {
+			break
+		}
+	}
+	p.expect(end)
+	return items, err
+}
+
+func (p *parser) primary() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case 's':
+		return t.value, nil
+	case 'n':
+		n, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			p.fail("bad number %q", t.value)
+		}
+		return n, nil
+	case 'i':
+		switch t.value {
+		case "true", "True":
+			return true, nil
+		case "false", "False":
+			return false, nil
+		case "none", "None":
+			return nil, nil
+		}
+		v, ok := p.vars[t.value]
+		if !ok {
+			return nil, errUndefined
+		}
+		return v, nil
+	case 'o':
+		switch t.value {
+		case "(":
+			v, err := p.or()
+			p.expect(")")
+			return v, err
+		case "[":
+			items, err := p.list("]")
+			return items, err
+		}
+	}
+	p.fail("unexpected %q", t.value)
+	return nil, nil
+}
+
+func (p *parser) filter(name string, v interface{}, err error, args []interface{}) (interface{}, error) {
+	if name == "default" {
+		if err == errUndefined || (err == nil && v == nil) {
+			if len(args) > 0 {
+				return args[0], nil
+			}
+			return "", nil
+		}
+		return v, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "lower":
+		return strings.ToLower(ToString(v)), nil
+	case "upper":
+		return strings.ToUpper(ToString(v)), nil
+	case "trim":
+		return strings.TrimSpace(ToString(v)), nil
+	case "replace":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("replace filter needs 2 arguments")
+		}
+		return strings.Replace(ToString(v), ToString(args[0]), ToString(args[1]), -1), nil
+	case "join":
+		sep := ""
+		if len(args) > 0 {
+			sep = ToString(args[0])
+		}
+		var items []string
+		for _, i := range toList(v) {
+			items = append(items, ToString(i))
+		}
+		return strings.Join(items, sep), nil
+	}
+	p.fail("unknown filter %q", name)
+	return nil, nil
+}
+
+func attr(v interface{}, key interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		r, ok := t[ToString(key)]
+		if !ok {
+			return nil, errUndefined
+		}
+		return r, nil
+	case map[string]string:
+		r, ok := t[ToString(key)]
+		if !ok {
+			return nil, errUndefined
+		}
+		return r, nil
+	case []interface{}:
+		i, ok := key.(int64)
+		if !ok || i < 0 || int(i) >= len(t) {
+			return nil, errUndefined
+		}
+		return t[i], nil
+	case []string:
+		i, ok := key.(int64)
+		if !ok || i < 0 || int(i) >= len(t) {
+			return nil, errUndefined
+		}
+		return t[i], nil
+	}
+	return nil, errUndefined
+}
+
+// Truthy follows Jinja2: false, none, zero, empty string, list and map are false
+func Truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return len(t) > 0
+	case int64:
+		return t != 0
+	case int:
+		return t != 0
+	case []interface{}:
+		return len(t) > 0
+	case []string:
+		return len(t) > 0
+	case map[string]interface{}:
+		return len(t) > 0
+	case map[string]string:
+		return len(t) > 0
+	}
+	return true
+}
+
+// ToString converts scalar to string, none is empty string
+func ToString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+	return fmt.Sprint(v)
+}
+
+func toList(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		return t
+	case []string:
+		var items []interface{}
+		for _, s := range t {
+			items = append(items, s)
+		}
+		return items
+	case map[string]string:
+		return toList(sortedKeys(t))
+	case map[string]interface{}:
+		var keys []string
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return toList(keys)
+	case nil:
+		return nil
+	}
+	return []interface{}{v}
+}
+
+func equal(l, r interface{}) bool {
+	if c, ok := compareValues(l, r); ok {
+		return c == 0
+	}
+	return ToString(l) == ToString(r) && (l == nil) == (r == nil)
+}
+
+func contains(container, item interface{}) bool {
+	switch t := container.(type) {
+	case string:
+		return strings.Contains(t, ToString(item))
+	case map[string]string:
+		_, ok := t[ToString(item)]
+		return ok
+	case map[string]interface{}:
+		_, ok := t[ToString(item)]
+		return ok
+	}
+	for _, i := range toList(container) {
+		if equal(i, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues compares numbers or strings
+func compareValues(l, r interface{}) (int, bool) {
+	ln, lok := l.(int64)
+	rn, rok := r.(int64)
+	if lok && rok {
+		switch {
+		case ln < rn:
+			return -1, true
+		case ln > rn:
+			return 1, true
+		}
+		return 0, true
+	}
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if lok && rok {
+		return strings.Compare(ls, rs), true
+	}
+	return 0, false
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isSyntaxError(err error) bool {
+	return errors.Is(err, errSyntax)
+}
@@ -0,0 +1,184 @@
+package inventory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func exprVars() Vars {
+	return Vars{
+		"name":   "Web-1",
+		"zone":   "ru-central1-a",
+		"cores":  int64(4),
+		"empty":  "",
+		"none":   nil,
+		"labels": map[string]interface{}{"env": "prod", "role": " web "},
+		"ips":    []interface{}{"10.0.0.1", "10.0.0.2"},
+		"tags":   []string{"a", "b"},
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		// Literals and access
+		{"'text'", "text"},
+		{`"a\"b"`, `a"b`},
+		{"42", int64(42)},
+		{"true", true},
+		{"None", nil},
+		{"[1, 'a']", []interface{}{int64(1), "a"}},
+		{"{{ name }}", "Web-1"},
+		{"labels.env", "prod"},
+		{"labels['env']", "prod"},
+		{"ips[1]", "10.0.0.2"},
+		{"tags[0]", "a"},
+		// Comparison and membership
+		{"cores == 4", true},
+		{"cores != 4", false},
+		{"cores > 2", true},
+		{"cores <= 3", false},
+		{"name < 'Z'", true},
+		{"'env' in labels", true},
+		{"'10.0.0.3' not in ips", true},
+		{"'central' in zone", true},
+		// Precedence: not binds looser than comparison, and binds tighter than or
+		{"not cores == 4", false},
+		{"not empty", true},
+		{"false and false or true", true},
+		{"true or false and false", true},
+		{"(true or false) and false", false},
+		{"labels.env == 'prod' and cores > 2", true},
+		{"empty or 'fallback'", "fallback"},
+		{"cores and name", "Web-1"},
+		// Concatenation
+		{"name ~ '-' ~ cores", "Web-1-4"},
+		{"cores + 1", int64(5)},
+		{"name + 1", "Web-11"},
+		{"1 + 2 ~ 'x'", "3x"},
+		// Tests
+		{"missing is defined", false},
+		{"missing is not defined", true},
+		{"name is defined", true},
+		{"labels.missing is defined", false},
+		{"ips[5] is not defined", true},
+		{"missing is not defined or missing == 1", true},
+		// Filters
+		{"missing | default('d')", "d"},
+		{"missing | default", ""},
+		{"none | default('d')", "d"},
+		{"name | default('d')", "Web-1"},
+		{"labels.missing | default(labels.env)", "prod"},
+		{"name | lower", "web-1"},
+		{"name | upper", "WEB-1"},
+		{"labels.role | trim", "web"},
+		{"zone | replace('-', '_')", "ru_central1_a"},
+		{"ips | join(',')", "10.0.0.1,10.0.0.2"},
+		{"tags | join", "ab"},
+		{"labels | join(' ')", "env role"},
+		{"name | lower | replace('-', '') | upper", "WEB1"},
+		{"missing | default('X') | lower", "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Eval(tt.expr, exprVars())
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("= %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		syntax bool
+	}{
+		{"missing", false},
+		{"labels.missing", false},
+		{"ips[5]", false},
+		{"missing == 1", false},
+		{"missing ~ 'a'", false},
+		{"missing | lower", false},
+		{"name < 1", false},
+		{"name | replace('a')", false},
+		{"'unterminated", true},
+		{"name ==", true},
+		{"name $ 1", true},
+		{"(name", true},
+		{"name name", true},
+		{"name | nosuch", true},
+		{"name is odd", true},
+		{"labels.", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Eval(tt.expr, exprVars())
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if isSyntaxError(err) != tt.syntax {
+				t.Errorf("syntax error = %v, want %v: %v", isSyntaxError(err), tt.syntax, err)
+			}
+		})
+	}
+	_, err := Eval("missing", exprVars())
+	if !errors.Is(err, errUndefined) {
+		t.Errorf("undefined variable error = %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		want string
+		err  bool
+	}{
+		{"name", "Web-1", false},
+		{"{{ name | lower }}", "web-1", false},
+		{"{{ labels.env }}-{{ name }}.example.com", "prod-Web-1.example.com", false},
+		{"host-{{ cores }}", "host-4", false},
+		{"{{ name", "", true},
+		{"{{ missing }}.example.com", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			got, err := Render(tt.tmpl, exprVars())
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("= %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want bool
+	}{
+		{nil, false},
+		{"", false},
+		{"a", true},
+		{int64(0), false},
+		{int64(2), true},
+		{false, false},
+		{[]interface{}{}, false},
+		{[]string{"a"}, true},
+		{map[string]interface{}{}, false},
+		{map[string]string{"a": "b"}, true},
+	}
+	for _, tt := range tests {
+		if got := Truthy(tt.v); got != tt.want {
+			t.Errorf("Truthy(%#v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package inventory
+
+import "sort"
+
+// Group is Ansible dynamic inventory group, HostVars are used by _meta group only
+type Group struct {
+	Hosts    []string               `json:"hosts,omitempty"`
+	Children []string               `json:"children,omitempty"`
+	Vars     map[string]interface{} `json:"vars,omitempty"`
+	HostVars map[string]Vars        `json:"hostvars,omitempty"`
+}
+
+// Inventory is Ansible dynamic inventory keyed by group name
+type Inventory map[string]Group
+type Vars map[string]interface{}
+
+const (
+	GroupAll  = "all"
+	GroupMeta = "_meta"
+)
+
+// AddHost adds host to group once, hosts are kept sorted
+func (inv Inventory) AddHost(group, host string) {
+	g := inv[group]
+	i := sort.SearchStrings(g.Hosts, host)
+	if i < len(g.Hosts) && g.Hosts[i] == host {
+		return
+	}
+	g.Hosts = append(g.Hosts, "")
+	copy(g.Hosts[i+1:], g.Hosts[i:])
+	g.Hosts[i] = host
+	inv[group] = g
+}
+
+// AddChild makes group child of parent group
+func (inv Inventory) AddChild(parent, child string) {
+	g := inv[parent]
+	for _, c := range g.Children {
+		if c == child {
+			return
+		}
+	}
+	g.Children = append(g.Children, child)
+	sort.Strings(g.Children)
+	inv[parent] = g
+}
+
+// SetHostVars replaces vars of host in _meta group
+func (inv Inventory) SetHostVars(host string, vars Vars) {
+	meta := inv[GroupMeta]
+	if meta.HostVars == nil {
+		meta.HostVars = map[string]Vars{}
+	}
+	meta.HostVars[host] = vars
+	inv[GroupMeta] = meta
+}
+
+// HostVars returns vars of host, nil for unknown host
+func (inv Inventory) HostVars(host string) Vars {
+	return inv[GroupMeta].HostVars[host]
+}
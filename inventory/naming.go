@@ -0,0 +1,211 @@
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"ya-ansible-inventory/cloud"
+)
+
+// Duplicate host name policies
+const (
+	DuplicateSuffix = "suffix"
+	DuplicateError  = "error"
+	DuplicateSkip   = "skip"
+)
+
+// Naming resolves host names, Hostnames are expressions or templates with {{ }},
+// first not empty value is host name
+type Naming struct {
+	Hostnames []string
+	// Duplicates is policy of hosts with equal names: every host of duplicated name is
+	// suffixed with id, hosts after the first one are skipped or names are reported as error
+	Duplicates string
+	Strict     bool
+}
+
+// CheckDuplicates validates duplicate policy, empty policy is suffix
+func CheckDuplicates(policy string) error {
+	switch policy {
+	case "", DuplicateSuffix, DuplicateError, DuplicateSkip:
+		return nil
+	}
+	return fmt.Errorf("Duplicate host names policy must be %s, %s or %s: %q", DuplicateSuffix, DuplicateError, DuplicateSkip, policy)
+}
+
+// Names returns name of every host, empty name means host is skipped
+func (n Naming) Names(hosts []cloud.Host, facts []Vars) ([]string, error) {
+	names := make([]string, len(hosts))
+	count := map[string]int{}
+	for i := range hosts {
+		name, err := n.hostname(facts[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hosts[i].GetId(), err)
+		}
+		names[i] = name
+		if len(name) > 0 {
+			count[name]++
+		}
+	}
+	var dups []string
+	// taken are names of unique hosts and generated names, suffixed names must not collide with them
+	taken := map[string]bool{}
+	for name, c := range count {
+		if c < 2 {
+			taken[name] = true
+		}
+	}
+	for i, name := range names {
+		if count[name] < 2 {
+			continue
+		}
+		switch n.Duplicates {
+		case DuplicateError:
+			if !contains(dups, name) {
+				dups = append(dups, name)
+			}
+		case DuplicateSkip:
+			if taken[name] {
+				names[i] = ""
+			}
+			taken[name] = true
+		default:
+			suffixed := name + "-" + SanitizeHost(hosts[i].GetId())
+			for k := 2; taken[suffixed]; k++ {
+				suffixed = fmt.Sprintf("%s-%s-%d", name, SanitizeHost(hosts[i].GetId()), k)
+			}
+			names[i] = suffixed
+			taken[suffixed] = true
+		}
+	}
+	if len(dups) > 0 {
+		sort.Strings(dups)
+		return nil, fmt.Errorf("Duplicate host names: %s", strings.Join(dups, ", "))
+	}
+	return names, nil
+}
+
+func (n Naming) hostname(vars Vars) (string, error) {
+	for _, expr := range n.Hostnames {
+		v, err := Render(expr, vars)
+		if err == errUndefined || (err != nil && !n.Strict && !isSyntaxError(err)) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if name := SanitizeHost(v); len(name) > 0 {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// SanitizeHost makes valid host name: characters other than letters, digits, dot, dash
+// and underscore are replaced with dash, leading and trailing dashes and dots are trimmed
+func SanitizeHost(name string) string {
+	b := []byte(strings.TrimSpace(name))
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			b[i] = '-'
+		}
+	}
+	return strings.Trim(string(b), "-.")
+}
+
+// LookupGroup returns name of group in inventory, name is looked up as is,
+// then sanitized and lowercased as NormalizeGroups could change it
+func (inv Inventory) LookupGroup(name string) (string, bool) {
+	for _, n := range []string{name, SanitizeGroup(name), strings.ToLower(name), strings.ToLower(SanitizeGroup(name))} {
+		if _, ok := inv[n]; ok {
+			return n, true
+		}
+	}
+	return name, false
+}
+
+// Render evaluates expression or renders template with {{ }} placeholders mixed with text
+func Render(tmpl string, vars Vars) (string, error) {
+	t := strings.TrimSpace(tmpl)
+	if !strings.Contains(t, "{{") || (strings.HasPrefix(t, "{{") && strings.HasSuffix(t, "}}") && strings.Count(t, "{{") == 1) {
+		v, err := Eval(t, vars)
+		return ToString(v), err
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(t, "{{")
+		if i < 0 {
+			b.WriteString(t)
+			return b.String(), nil
+		}
+		j := strings.Index(t[i:], "}}")
+		if j < 0 {
+			return "", fmt.Errorf("%w: unterminated {{ in %q", errSyntax, tmpl)
+		}
+		v, err := Eval(t[i+2:i+j], vars)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(t[:i])
+		b.WriteString(ToString(v))
+		t = t[i+j+2:]
+	}
+}
+
+// NormalizeGroups optionally sanitizes and lowercases group names, groups with equal
+// normalized names are merged. Names are kept as is by default, keyed groups are always sanitized
+func (inv Inventory) NormalizeGroups(sanitize, lowercase bool) {
+	if !sanitize && !lowercase {
+		return
+	}
+	normalize := func(name string) string {
+		if name == GroupAll || name == GroupMeta {
+			return name
+		}
+		if sanitize {
+			name = SanitizeGroup(name)
+		}
+		if lowercase {
+			name = strings.ToLower(name)
+		}
+		return name
+	}
+	var names []string
+	for name := range inv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g := inv[name]
+		var children []string
+		for _, c := range g.Children {
+			if c = normalize(c); !contains(children, c) {
+				children = append(children, c)
+			}
+		}
+		sort.Strings(children)
+		g.Children = children
+		norm := normalize(name)
+		if norm == name {
+			inv[name] = g
+			continue
+		}
+		delete(inv, name)
+		for _, h := range g.Hosts {
+			inv.AddHost(norm, h)
+		}
+		for _, c := range g.Children {
+			inv.AddChild(norm, c)
+		}
+		merged := inv[norm]
+		for k, v := range g.Vars {
+			if merged.Vars == nil {
+				merged.Vars = map[string]interface{}{}
+			}
+			if _, ok := merged.Vars[k]; !ok {
+				merged.Vars[k] = v
+			}
+		}
+		inv[norm] = merged
+	}
+}
@@ -0,0 +1,88 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+	"ya-ansible-inventory/cloud"
+)
+
+func namedHosts(names ...string) ([]cloud.Host, []Vars) {
+	var hosts []cloud.Host
+	var facts []Vars
+	for i, name := range names {
+		h := fakeHost{name: name, id: string(rune('a' + i))}
+		hosts = append(hosts, h)
+		facts = append(facts, HostFacts(h))
+	}
+	return hosts, facts
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		hosts      []string
+		duplicates string
+		want       []string
+		err        bool
+	}{
+		{"unique", []string{"web", "db"}, "", []string{"web", "db"}, false},
+		{"suffix", []string{"web", "web", "db"}, DuplicateSuffix, []string{"web-a", "web-b", "db"}, false},
+		{"suffix collision", []string{"web", "web", "web-a"}, DuplicateSuffix, []string{"web-a-2", "web-b", "web-a"}, false},
+		{"skip keeps first", []string{"web", "db", "web", "web"}, DuplicateSkip, []string{"web", "db", "", ""}, false},
+		{"error", []string{"web", "web"}, DuplicateError, nil, true},
+		{"sanitized", []string{" web 1 ", "db\t2", "--"}, "", []string{"web-1", "db-2", ""}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, facts := namedHosts(tt.hosts...)
+			got, err := Naming{Hostnames: []string{"name"}, Duplicates: tt.duplicates}.Names(hosts, facts)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("names = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamesFallback(t *testing.T) {
+	h := fakeHost{name: "", id: "i-1", privateDNS: "web.internal"}
+	got, err := Naming{Hostnames: []string{"name", "labels.host", "private_dns"}}.Names([]cloud.Host{h}, []Vars{HostFacts(h)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"web.internal"}) {
+		t.Errorf("names = %q", got)
+	}
+}
+
+func TestNormalizeGroups(t *testing.T) {
+	inv := Inventory{}
+	inv.AddHost("Web-Prod", "a")
+	inv.AddHost("web_prod", "b")
+	inv.AddChild("all-hosts", "Web-Prod")
+
+	kept := Inventory{}
+	for k, v := range inv {
+		kept[k] = v
+	}
+	kept.NormalizeGroups(false, false)
+	if !reflect.DeepEqual(kept, inv) {
+		t.Errorf("groups changed without normalization: %v", kept)
+	}
+
+	inv.NormalizeGroups(true, true)
+	if got := inv["web_prod"].Hosts; !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("web_prod hosts = %v", got)
+	}
+	if got := inv["all_hosts"].Children; !reflect.DeepEqual(got, []string{"web_prod"}) {
+		t.Errorf("all_hosts children = %v", got)
+	}
+	if _, ok := inv["Web-Prod"]; ok {
+		t.Error("Web-Prod is not merged")
+	}
+	if name, ok := inv.LookupGroup("Web-Prod"); !ok || name != "web_prod" {
+		t.Errorf("LookupGroup(Web-Prod) = %s, %v", name, ok)
+	}
+}
@@ -0,0 +1,117 @@
+package inventory
+
+import (
+	"sort"
+	"ya-ansible-inventory/cloud"
+	"ya-ansible-inventory/common"
+)
+
+// NetworkFacts attach subnets and VPCs to groups and hosts: group gets subnets passing
+// inventory filter, host gets subnets of its interfaces
+type NetworkFacts struct {
+	Groups []string `yaml:"groups"`
+	Hosts  bool     `yaml:"hosts"`
+}
+
+// Apply adds network vars tf_subnets with CIDRs, tf_subnet_ids, tf_subnet_names, tf_vpc_ids and tf_vpc_names,
+// groups absent in inventory are ignored. Hosts are keyed by inventory name
+func (nf NetworkFacts) Apply(inv Inventory, c cloud.Cloud, filter cloud.Filter, hosts map[string]cloud.Host) error {
+	var groups []string
+	for _, g := range nf.Groups {
+		if name, ok := inv.LookupGroup(g); ok && !contains(groups, name) {
+			groups = append(groups, name)
+		}
+	}
+	if len(groups) < 1 && !nf.Hosts {
+		return nil
+	}
+	subnets, err := c.GetSubnets(nil)
+	if err != nil {
+		return err
+	}
+	vpcs, err := c.GetVpcs(nil)
+	if err != nil {
+		return err
+	}
+	vpcNames := map[string]string{}
+	for _, v := range vpcs {
+		vpcNames[v.GetId()] = v.GetName()
+	}
+	if len(groups) > 0 {
+		var selected []cloud.Subnet
+		for _, s := range subnets {
+			if filter == nil || filter.Check(s) {
+				selected = append(selected, s)
+			}
+		}
+		vars := subnetVars(selected, vpcNames)
+		for _, name := range groups {
+			g := inv[name]
+			if g.Vars == nil {
+				g.Vars = map[string]interface{}{}
+			}
+			for k, v := range vars {
+				g.Vars[k] = v
+			}
+			inv[name] = g
+		}
+	}
+	if nf.Hosts {
+		byId := map[string]cloud.Subnet{}
+		for _, s := range subnets {
+			byId[s.GetId()] = s
+		}
+		for name, h := range hosts {
+			if !common.Contains(inv[GroupAll].Hosts, name) {
+				continue
+			}
+			var own []cloud.Subnet
+			for _, id := range h.GetInterfaces().Subnets {
+				if s, ok := byId[id]; ok {
+					own = append(own, s)
+				}
+			}
+			hv := inv.HostVars(name)
+			if hv == nil {
+				hv = Vars{}
+			}
+			for k, v := range subnetVars(own, vpcNames) {
+				hv[k] = v
+			}
+			inv.SetHostVars(name, hv)
+		}
+	}
+	return nil
+}
+
+// HostsByName maps inventory names to hosts, hosts without name are skipped
+func HostsByName(hosts []cloud.Host, names []string) map[string]cloud.Host {
+	res := map[string]cloud.Host{}
+	for i, name := range names {
+		if len(name) > 0 {
+			res[name] = hosts[i]
+		}
+	}
+	return res
+}
+
+func subnetVars(subnets []cloud.Subnet, vpcNames map[string]string) map[string]interface{} {
+	cidrs, ids, names, vpcIds, vpcs := []string{}, []string{}, []string{}, []string{}, []string{}
+	for _, s := range subnets {
+		cidrs = append(cidrs, s.GetCidrs()...)
+		ids = append(ids, s.GetId())
+		names = append(names, s.GetName())
+		if vpc := s.GetVPCId(); !common.Contains(vpcIds, vpc) {
+			vpcIds = append(vpcIds, vpc)
+			vpcs = append(vpcs, vpcNames[vpc])
+		}
+	}
+	sort.Strings(cidrs)
+	return map[string]interface{}{
+		"tf_subnets":      cidrs,
+		"tf_subnet_ids":   ids,
+		"tf_subnet_names": names,
+		"tf_vpc_ids":      vpcIds,
+		"tf_vpc_names":    vpcs,
+	}
+}
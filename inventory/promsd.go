@@ -0,0 +1,128 @@
+package inventory
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"ya-ansible-inventory/cloud"
+)
+
+// TargetGroup is target group of Prometheus file_sd file
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// PromSD makes Prometheus file_sd targets of inventory hosts
+type PromSD struct {
+	// Address is hostvar with target address
+	Address string
+	// Ports are target ports of hosts of group and its children
+	Ports map[string]int
+	// DefaultPort is port of hosts out of Ports groups, such hosts are skipped if it is 0
+	DefaultPort int
+	// Labels are added to all targets, empty values are skipped
+	Labels map[string]string
+}
+
+// ParsePorts parses comma separated group=port list, port without group is default port
+func ParsePorts(spec string) (map[string]int, int, error) {
+	ports := map[string]int{}
+	def := 0
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); len(item) < 1 {
+			continue
+		}
+		group, value := "", item
+		if i := strings.LastIndex(item, "="); i >= 0 {
+			group, value = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, 0, fmt.Errorf("Bad port: %s", item)
+		}
+		if len(group) < 1 {
+			def = port
+		} else {
+			ports[group] = port
+		}
+	}
+	return ports, def, nil
+}
+
+// Targets returns target group per host and port, labels are cloud labels of host,
+// PromSD labels, group of port and instance with inventory host name
+func (p PromSD) Targets(inv Inventory, hosts map[string]cloud.Host) []TargetGroup {
+	res := []TargetGroup{}
+	ported := map[string]bool{}
+	var groups []string
+	for g := range p.Ports {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	for _, g := range groups {
+		// port keys are given as typed by user, group names may be sanitized
+		name, _ := inv.LookupGroup(g)
+		for _, h := range inv.GroupHosts(name) {
+			ported[h] = true
+			if tg, ok := p.target(inv, hosts[h], h, name, p.Ports[g]); ok {
+				res = append(res, tg)
+			}
+		}
+	}
+	if p.DefaultPort > 0 {
+		for _, h := range inv.GroupHosts(GroupAll) {
+			if ported[h] {
+				continue
+			}
+			if tg, ok := p.target(inv, hosts[h], h, GroupAll, p.DefaultPort); ok {
+				res = append(res, tg)
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Targets[0] < res[j].Targets[0] })
+	return res
+}
+
+// target returns target group of host, hosts without address are skipped
+func (p PromSD) target(inv Inventory, h cloud.Host, name, group string, port int) (TargetGroup, bool) {
+	address, _ := inv.HostVars(name)[p.Address].(string)
+	if len(address) < 1 {
+		return TargetGroup{}, false
+	}
+	labels := map[string]string{}
+	if h != nil {
+		for k, v := range h.GetLabels() {
+			if k = PromLabel(k); len(k) > 0 {
+				labels[k] = v
+			}
+		}
+	}
+	for k, v := range p.Labels {
+		if len(v) > 0 {
+			labels[k] = v
+		}
+	}
+	labels["group"] = group
+	labels["instance"] = name
+	return TargetGroup{
+		Targets: []string{net.JoinHostPort(address, strconv.Itoa(port))},
+		Labels:  labels,
+	}, true
+}
+
+// PromLabel returns valid Prometheus label name, names reserved with __ prefix are dropped
+func PromLabel(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	if strings.HasPrefix(string(b), "__") {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,73 @@
+package inventory
+
+import "sort"
+
+// GroupHosts returns hosts of group and of its children, sorted
+func (inv Inventory) GroupHosts(group string) []string {
+	hosts := []string{}
+	seen := map[string]bool{}
+	var walk func(name string)
+	walk = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		g := inv[name]
+		for _, h := range g.Hosts {
+			if !contains(hosts, h) {
+				hosts = append(hosts, h)
+			}
+		}
+		for _, c := range g.Children {
+			walk(c)
+		}
+	}
+	walk(group)
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Select returns copy of inventory with hosts passing keep, groups left without hosts
+// and children are dropped, all and _meta groups are always kept
+func (inv Inventory) Select(keep func(host string) bool) Inventory {
+	res := Inventory{}
+	for name, g := range inv {
+		if name == GroupMeta {
+			continue
+		}
+		var hosts []string
+		for _, h := range g.Hosts {
+			if keep(h) {
+				hosts = append(hosts, h)
+			}
+		}
+		g.Hosts = hosts
+		res[name] = g
+	}
+	// Dropping of empty group may leave its parent empty
+	for dropped := true; dropped; {
+		dropped = false
+		for name, g := range res {
+			var children []string
+			for _, c := range g.Children {
+				if _, ok := res[c]; ok {
+					children = append(children, c)
+				}
+			}
+			g.Children = children
+			res[name] = g
+			if name != GroupAll && len(g.Hosts) < 1 && len(children) < 1 {
+				delete(res, name)
+				dropped = true
+			}
+		}
+	}
+	meta := Group{HostVars: map[string]Vars{}}
+	for h, vars := range inv[GroupMeta].HostVars {
+		if keep(h) {
+			meta.HostVars[h] = vars
+		}
+	}
+	res[GroupMeta] = meta
+	return res
+}
@@ -0,0 +1,91 @@
+package inventory
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+	"ya-ansible-inventory/config"
+)
+
+// PluginName is plugin value of inventory source files
+const PluginName = "ya_cloud"
+
+// KeyedGroup makes groups named by expression value: one group for string, group per item
+// for list and group per key and value pair for map
+type KeyedGroup struct {
+	Key          string `yaml:"key"`
+	Prefix       string `yaml:"prefix"`
+	Separator    string `yaml:"separator"`
+	DefaultValue string `yaml:"default_value"`
+	ParentGroup  string `yaml:"parent_group"`
+	// LeadingSeparator keeps separator before value for empty prefix, true by default as in Ansible
+	LeadingSeparator *bool `yaml:"leading_separator"`
+}
+
+// Filters select hosts of source
+type Filters struct {
+	Labels map[string]string `yaml:"labels"`
+}
+
+// Source is Ansible inventory plugin style YAML file, compose and groups keep file order
+type Source struct {
+	Plugin      string        `yaml:"plugin"`
+	CloudType   string        `yaml:"cloud_type"`
+	Filters     Filters       `yaml:"filters"`
+	Strict      bool          `yaml:"strict"`
+	Compose     yaml.MapSlice `yaml:"compose"`
+	Groups      yaml.MapSlice `yaml:"groups"`
+	KeyedGroups []KeyedGroup  `yaml:"keyed_groups"`
+	Hostnames   []string      `yaml:"hostnames"`
+	// Duplicates is policy of duplicate host names: suffix, error or skip
+	Duplicates      string `yaml:"duplicates"`
+	SanitizeGroups  bool   `yaml:"sanitize_groups"`
+	LowercaseGroups bool   `yaml:"lowercase_groups"`
+	// NetworkFacts adds subnet and VPC vars to groups and hosts, no network API calls without it
+	NetworkFacts NetworkFacts `yaml:"network_facts"`
+}
+
+// LoadSource reads inventory source file, ENV references in filter values are expanded
+func LoadSource(path string) (*Source, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Source{}
+	err = yaml.UnmarshalStrict(b, s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Plugin != PluginName && !strings.HasSuffix(s.Plugin, "."+PluginName) {
+		return nil, fmt.Errorf("%s: plugin must be %s, got %q", path, PluginName, s.Plugin)
+	}
+	s.CloudType = config.Expand(s.CloudType)
+	for k, v := range s.Filters.Labels {
+		s.Filters.Labels[k] = config.Expand(v)
+	}
+	for _, kv := range append(append(yaml.MapSlice{}, s.Compose...), s.Groups...) {
+		if _, ok := kv.Key.(string); !ok {
+			return nil, fmt.Errorf("%s: bad name %v", path, kv.Key)
+		}
+		if _, ok := kv.Value.(string); !ok {
+			return nil, fmt.Errorf("%s: %v: expression must be string", path, kv.Key)
+		}
+	}
+	for i, kg := range s.KeyedGroups {
+		if len(kg.Key) < 1 {
+			return nil, fmt.Errorf("%s: keyed_groups[%d]: key is not set", path, i)
+		}
+		if len(kg.Separator) < 1 {
+			s.KeyedGroups[i].Separator = "_"
+		}
+	}
+	err = CheckDuplicates(s.Duplicates)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(s.Hostnames) < 1 {
+		s.Hostnames = []string{"name"}
+	}
+	return s, nil
+}